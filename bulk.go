@@ -0,0 +1,306 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	//maxPlaceholders is the most placeholders MySQL accepts in one prepared statement
+	maxPlaceholders = 65535
+
+	//defaultMaxPacket is used when @@max_allowed_packet can't be read (the MySQL 5.7 default)
+	defaultMaxPacket = 4 * 1024 * 1024
+)
+
+//BulkOptions tunes BulkInsert. The zero value inserts every db-tagged
+//column, in statements as large as the server allows.
+type BulkOptions struct {
+	Columns   []string //Columns (db tags) to insert; all when empty
+	MaxRows   int      //Most rows per statement; no limit beyond the ones below when 0
+	MaxPacket int      //Most bytes per statement; @@max_allowed_packet when 0
+	Ignore    bool     //Use INSERT IGNORE
+}
+
+//BulkResult summarizes a chunked bulk statement
+type BulkResult struct {
+	RowsAffected int64 //Sum of rows affected over the chunks that succeeded
+	Chunks       int   //Number of chunks (statements) that succeeded
+}
+
+//ChunkError reports which chunk of a chunked operation failed.
+//Chunks before it have already been executed.
+type ChunkError struct {
+	Chunk  int   //Index of the failed chunk, from 0
+	Offset int   //Index of the chunk's first item in the input
+	Rows   int   //Number of items in the chunk
+	Err    error //Error the chunk failed with
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d (items %d-%d): %v", e.Chunk, e.Offset, e.Offset+e.Rows-1, e.Err)
+}
+
+//Unwrap returns the chunk's error
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+//BulkInsert inserts rows, a slice of structs or struct pointers, into table
+//using multi-row INSERT ... VALUES (...), (...) statements. Column names
+//come from the structs' db tags. Rows are split into chunks that stay under
+//MySQL's 65535 placeholder limit, max_allowed_packet, and opts.MaxRows.
+//On failure the error is a *ChunkError; earlier chunks are not undone
+//unless BulkInsert runs inside WithTx (see Tx.BulkInsert).
+func (db *DB) BulkInsert(ctx context.Context, table string, rows interface{}, opts BulkOptions) (BulkResult, error) {
+	return db.runner().bulkInsert(ctx, table, rows, opts)
+}
+
+//BulkInsert is DB.BulkInsert inside the transaction
+func (tx *Tx) BulkInsert(ctx context.Context, table string, rows interface{}, opts BulkOptions) (BulkResult, error) {
+	return tx.runner().bulkInsert(ctx, table, rows, opts)
+}
+
+func (r runner) bulkInsert(ctx context.Context, table string, rows interface{}, opts BulkOptions) (BulkResult, error) {
+	values, fields, err := bulkRows(rows, opts.Columns)
+	if err != nil || values.Len() == 0 {
+		return BulkResult{}, err
+	}
+
+	verb := "INSERT"
+	if opts.Ignore {
+		verb = "INSERT IGNORE"
+	}
+
+	return r.insertChunks(ctx, verb+" INTO "+quoteIdentifier(table), "", fields, values, opts)
+}
+
+//bulkRows validates rows (a slice, or pointer to one) and resolves
+//the fields for columns, or all db-tagged fields if columns is empty
+func bulkRows(rows interface{}, columns []string) (reflect.Value, []dbField, error) {
+	values := reflect.ValueOf(rows)
+	for values.Kind() == reflect.Ptr {
+		values = values.Elem()
+	}
+
+	if values.Kind() != reflect.Slice && values.Kind() != reflect.Array {
+		return reflect.Value{}, nil, fmt.Errorf("expected slice of structs, got %T", rows)
+	}
+
+	t, err := structType(values.Type())
+	if err != nil {
+		return reflect.Value{}, nil, err
+	}
+
+	fields, err := selectFields(dbFields(t), columns)
+	if err != nil {
+		return reflect.Value{}, nil, err
+	}
+
+	if len(fields) == 0 {
+		return reflect.Value{}, nil, fmt.Errorf("%v has no db-tagged fields", t)
+	}
+
+	return values, fields, nil
+}
+
+//selectFields returns the fields for columns, in the order given.
+//All fields are returned when columns is empty.
+func selectFields(fields []dbField, columns []string) ([]dbField, error) {
+	if len(columns) == 0 {
+		return fields, nil
+	}
+
+	byColumn := map[string]dbField{}
+	for _, f := range fields {
+		byColumn[f.Column] = f
+	}
+
+	selected := make([]dbField, 0, len(columns))
+	for _, c := range columns {
+		f, ok := byColumn[c]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q", c)
+		}
+		selected = append(selected, f)
+	}
+
+	return selected, nil
+}
+
+//insertChunks executes "<prefix> (columns) VALUES (...), (...) <suffix>"
+//for the rows in values, as many chunks as the limits require
+func (r runner) insertChunks(ctx context.Context, prefix, suffix string, fields []dbField, values reflect.Value, opts BulkOptions) (BulkResult, error) {
+	var result BulkResult
+
+	maxPacket := opts.MaxPacket
+	if maxPacket <= 0 {
+		maxPacket = r.maxAllowedPacket(ctx)
+	}
+	//Leave room for packet headers and escaping
+	maxPacket = maxPacket * 9 / 10
+
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = quoteIdentifier(f.Column)
+	}
+	head := prefix + " (" + strings.Join(columns, ", ") + ") VALUES "
+	rowSQL := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(fields)), ", ") + ")"
+
+	var args []interface{}
+	chunkRows, chunkStart, chunkSize := 0, 0, 0
+
+	flush := func() error {
+		if chunkRows == 0 {
+			return nil
+		}
+
+		query := head + strings.TrimSuffix(strings.Repeat(rowSQL+", ", chunkRows), ", ") + suffix
+		res, err := r.execContext(ctx, query, args...)
+		if err != nil {
+			return &ChunkError{Chunk: result.Chunks, Offset: chunkStart, Rows: chunkRows, Err: err}
+		}
+
+		if n, err := res.RowsAffected(); err == nil {
+			result.RowsAffected += n
+		}
+		result.Chunks++
+
+		args = args[:0]
+		chunkStart += chunkRows
+		chunkRows, chunkSize = 0, 0
+		return nil
+	}
+
+	for i := 0; i < values.Len(); i++ {
+		row, err := rowArgs(values.Index(i), fields)
+		if err != nil {
+			return result, fmt.Errorf("row %d: %v", i, err)
+		}
+
+		size := len(rowSQL) + 2
+		for _, a := range row {
+			size += argSize(a)
+		}
+
+		full := (opts.MaxRows > 0 && chunkRows >= opts.MaxRows) ||
+			len(args)+len(row) > maxPlaceholders ||
+			len(head)+len(suffix)+chunkSize+size > maxPacket
+		if chunkRows > 0 && full {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+
+		args = append(args, row...)
+		chunkRows++
+		chunkSize += size
+	}
+
+	return result, flush()
+}
+
+//rowArgs returns the values of fields in the struct (or struct pointer) v.
+//driver.Valuer values are resolved so their size can be estimated.
+func rowArgs(v reflect.Value, fields []dbField) ([]interface{}, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, fmt.Errorf("nil row")
+		}
+		v = v.Elem()
+	}
+
+	args := make([]interface{}, len(fields))
+	for i, f := range fields {
+		value, err := driverValue(fieldValue(v, f.Index).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", f.Column, err)
+		}
+
+		args[i] = value
+	}
+
+	return args, nil
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+//driverValue resolves a driver.Valuer the way database/sql does: a nil
+//pointer to a type whose Value has a value receiver, such as a nil
+//*sql.NullString, is NULL rather than a panic
+func driverValue(value interface{}) (interface{}, error) {
+	valuer, ok := value.(driver.Valuer)
+	if !ok {
+		return value, nil
+	}
+
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Ptr && rv.IsNil() && rv.Type().Elem().Implements(valuerType) {
+		return nil, nil
+	}
+
+	return valuer.Value()
+}
+
+//argSize estimates the bytes an argument takes up on the wire. Pointers
+//are followed, and strings and byte slices are sized by kind so named
+//types like json.RawMessage count in full.
+func argSize(arg interface{}) int {
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 4
+		}
+		v = v.Elem()
+	}
+
+	switch {
+	case !v.IsValid():
+		return 4
+	case v.Kind() == reflect.String:
+		return v.Len() + 2
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		return v.Len() + 2
+	}
+
+	switch x := v.Interface().(type) {
+	case time.Time:
+		return 28
+	case fmt.Stringer:
+		return len(x.String()) + 2
+	}
+	return 20
+}
+
+//maxAllowedPacket returns the server's max_allowed_packet setting,
+//read once per DB
+func (r runner) maxAllowedPacket(ctx context.Context) int {
+	if r.server != nil {
+		r.server.mu.Lock()
+		size := r.server.maxPacket
+		r.server.mu.Unlock()
+
+		if size > 0 {
+			return size
+		}
+	}
+
+	//Not under the lock: waiting for a connection while holding it
+	//would block transactions that already have one
+	var size int
+	if err := r.h.QueryRowxContext(ctx, "SELECT @@max_allowed_packet").Scan(&size); err != nil || size <= 0 {
+		r.log.Log(ctx, LevelWarn, "could not read max_allowed_packet", "error", err, "default", defaultMaxPacket)
+		return defaultMaxPacket
+	}
+
+	if r.server != nil {
+		r.server.mu.Lock()
+		r.server.maxPacket = size
+		r.server.mu.Unlock()
+	}
+
+	return size
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type nullableRow struct {
+	Name *sql.NullString `db:"name"`
+	Note sql.NullString  `db:"note"`
+}
+
+func TestRowArgsNilValuer(t *testing.T) {
+	row := nullableRow{Note: sql.NullString{String: "n", Valid: true}}
+
+	args, err := rowArgs(reflect.ValueOf(row), dbFields(reflect.TypeOf(row)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args[0] != nil || args[1] != "n" {
+		t.Errorf("args = %#v, want nil and \"n\"", args)
+	}
+}
+
+type label string
+
+func TestArgSize(t *testing.T) {
+	text := "hello"
+
+	tests := []struct {
+		name string
+		arg  interface{}
+		want int
+	}{
+		{"nil", nil, 4},
+		{"nil pointer", (*string)(nil), 4},
+		{"string", text, 7},
+		{"string pointer", &text, 7},
+		{"named string", label(text), 7},
+		{"bytes", []byte(text), 7},
+		{"json.RawMessage", json.RawMessage(`{"a":1}`), 9},
+		{"time", time.Now(), 28},
+		{"int", 5, 20},
+	}
+
+	for _, tt := range tests {
+		if got := argSize(tt.arg); got != tt.want {
+			t.Errorf("%s: argSize = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+//Command dbtool runs migrations, SQL files and ad-hoc queries against a
+//MySQL database.
+//
+//	dbtool [-dsn DSN] migrate [-dir DIR] [-dry-run] up|down [N]|status|new NAME
+//	dbtool [-dsn DSN] exec [-tx] [-continue] FILE
+//	dbtool [-dsn DSN] query [-format table|csv|json] SQL
+//
+//The DSN (e.g. user:pass@tcp(localhost:3306)/app) defaults to the
+//DBTOOL_DSN environment variable. FILE and SQL may be "-" for stdin.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bjbigler/database"
+)
+
+const usage = `usage:
+  dbtool [-dsn DSN] migrate [-dir DIR] [-dry-run] up|down [N]|status|new NAME
+  dbtool [-dsn DSN] exec [-tx] [-continue] FILE
+  dbtool [-dsn DSN] query [-format table|csv|json] SQL
+
+The DSN defaults to $DBTOOL_DSN. FILE and SQL may be "-" for stdin.
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	dsn := flag.String("dsn", os.Getenv("DBTOOL_DSN"), "MySQL DSN")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	connect := func() (*database.DB, error) {
+		if *dsn == "" {
+			return nil, fmt.Errorf("no DSN: set -dsn or DBTOOL_DSN")
+		}
+		return database.ConnectContext(ctx, *dsn)
+	}
+
+	var err error
+	switch cmd, args := flag.Arg(0), flag.Args()[1:]; cmd {
+	case "migrate":
+		err = migrate(ctx, connect, args)
+	case "exec":
+		err = execFile(ctx, connect, args)
+	case "query":
+		err = query(ctx, connect, args)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "dbtool:", err)
+		os.Exit(1)
+	}
+}
+
+func migrate(ctx context.Context, connect func() (*database.DB, error), args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dir := fs.String("dir", "migrations", "migrations directory")
+	dryRun := fs.Bool("dry-run", false, "print the steps without running them")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("migrate needs up, down, status or new")
+	}
+
+	//new only writes files, so it works without a database
+	if fs.Arg(0) == "new" {
+		if fs.NArg() != 2 {
+			return fmt.Errorf("migrate new needs a name")
+		}
+		return newMigration(*dir, fs.Arg(1))
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m, err := database.NewMigrator(db, os.DirFS(*dir))
+	if err != nil {
+		return err
+	}
+	m.DryRun = *dryRun
+
+	var steps []database.MigrationStep
+	switch fs.Arg(0) {
+	case "up":
+		steps, err = m.Up(ctx)
+	case "down":
+		n := 1
+		if fs.NArg() > 1 {
+			if n, err = strconv.Atoi(fs.Arg(1)); err != nil || n < 1 {
+				return fmt.Errorf("migrate down: count must be a positive number, got %q", fs.Arg(1))
+			}
+		}
+		steps, err = m.Down(ctx, n)
+	case "status":
+		return printStatus(ctx, m)
+	default:
+		return fmt.Errorf("unknown migrate command %q", fs.Arg(0))
+	}
+
+	for _, s := range steps {
+		direction := "down"
+		if s.Up {
+			direction = "up"
+		}
+
+		if *dryRun {
+			fmt.Printf("-- %04d_%s.%s.sql\n%s\n", s.Version, s.Name, direction, strings.TrimSpace(s.SQL))
+		} else {
+			fmt.Printf("%s %04d %s\n", direction, s.Version, s.Name)
+		}
+	}
+	if err == nil && len(steps) == 0 {
+		fmt.Println("nothing to do")
+	}
+
+	return err
+}
+
+func printStatus(ctx context.Context, m *database.Migrator) error {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	t := newTable(os.Stdout, []string{"version", "name", "state", "applied at"})
+	for _, s := range status {
+		state, at := "pending", ""
+		if s.Applied {
+			state, at = "applied", s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		if s.Modified {
+			state = "modified"
+		}
+		if s.Missing {
+			state = "missing"
+		}
+		t.row([]interface{}{fmt.Sprintf("%04d", s.Version), s.Name, state, at})
+	}
+
+	return t.flush()
+}
+
+//newMigration creates empty up and down files numbered after the last migration
+func newMigration(dir, name string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	m, err := database.NewMigrator(nil, os.DirFS(dir))
+	if err != nil {
+		return err
+	}
+
+	var version int64 = 1
+	if all := m.Migrations(); len(all) > 0 {
+		version = all[len(all)-1].Version + 1
+	}
+
+	name = strings.ReplaceAll(strings.TrimSpace(name), " ", "_")
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		f.Close()
+		fmt.Println(path)
+	}
+
+	return nil
+}
+
+func execFile(ctx context.Context, connect func() (*database.DB, error), args []string) error {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	tx := fs.Bool("tx", false, "run the file in one transaction")
+	cont := fs.Bool("continue", false, "keep going after a failed statement")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("exec needs one file")
+	}
+
+	script, err := readArg(fs.Arg(0), true)
+	if err != nil {
+		return err
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	errs := db.ExecScript(ctx, script, database.ScriptOptions{
+		Transaction:     *tx,
+		ContinueOnError: *cont,
+		Progress: func(p database.ScriptProgress) {
+			if p.Err == nil {
+				fmt.Fprintf(os.Stderr, "[%d/%d] ok (%v)\n", p.Index+p.Count, p.Total, p.Duration.Round(time.Microsecond))
+			}
+		},
+	})
+	for _, err := range errs {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d statement(s) failed", len(errs))
+	}
+
+	return nil
+}
+
+func query(ctx context.Context, connect func() (*database.DB, error), args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	format := fs.String("format", "table", "output format: table, csv or json")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("query needs SQL")
+	}
+
+	sql, err := readArg(strings.Join(fs.Args(), " "), false)
+	if err != nil {
+		return err
+	}
+
+	out, err := newOutput(*format, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return printRows(ctx, db, sql, out)
+}
+
+//readArg returns arg, or the contents of stdin when arg is "-" or of the
+//file arg names when isFile is set
+func readArg(arg string, isFile bool) (string, error) {
+	var b []byte
+	var err error
+
+	switch {
+	case arg == "-":
+		b, err = io.ReadAll(os.Stdin)
+	case isFile:
+		b, err = os.ReadFile(arg)
+	default:
+		return arg, nil
+	}
+
+	return string(b), err
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bjbigler/database"
+	"github.com/jmoiron/sqlx"
+)
+
+//output writes query results in one format
+type output interface {
+	header(columns []string) error
+	row(values []interface{}) error
+	flush() error
+}
+
+func newOutput(format string, w io.Writer) (output, error) {
+	switch format {
+	case "table":
+		return &tableOutput{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}, nil
+	case "csv":
+		return &csvOutput{w: csv.NewWriter(w)}, nil
+	case "json":
+		return &jsonOutput{w: bufio.NewWriter(w)}, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+//printRows runs query and writes its rows to out
+func printRows(ctx context.Context, db *database.DB, query string, out output) error {
+	var writeErr error
+
+	err := db.GetRowsContext(ctx, func(rows *sqlx.Rows) {
+		columns, err := rows.Columns()
+		if err != nil {
+			writeErr = err
+			return
+		}
+		if writeErr = out.header(columns); writeErr != nil {
+			return
+		}
+
+		for rows.Next() {
+			values, err := rows.SliceScan()
+			if err != nil {
+				writeErr = err
+				return
+			}
+			if writeErr = out.row(values); writeErr != nil {
+				return
+			}
+		}
+	}, query)
+
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	return out.flush()
+}
+
+//text formats a column value for table and CSV output
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	}
+	return fmt.Sprint(v)
+}
+
+type tableOutput struct {
+	w *tabwriter.Writer
+}
+
+//newTable is a table output with its header already written
+func newTable(w io.Writer, columns []string) *tableOutput {
+	t := &tableOutput{w: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}
+	t.header(columns)
+	return t
+}
+
+func (t *tableOutput) header(columns []string) error {
+	rule := make([]string, len(columns))
+	for i, c := range columns {
+		rule[i] = strings.Repeat("-", len(c))
+	}
+
+	_, err := fmt.Fprintf(t.w, "%s\n%s\n", strings.Join(columns, "\t"), strings.Join(rule, "\t"))
+	return err
+}
+
+func (t *tableOutput) row(values []interface{}) error {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		//Tabs and newlines would break the alignment
+		cells[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(text(v))
+	}
+
+	_, err := fmt.Fprintln(t.w, strings.Join(cells, "\t"))
+	return err
+}
+
+func (t *tableOutput) flush() error {
+	return t.w.Flush()
+}
+
+type csvOutput struct {
+	w *csv.Writer
+}
+
+func (c *csvOutput) header(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c *csvOutput) row(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		if v != nil {
+			record[i] = text(v)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvOutput) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+//jsonOutput writes an array of objects, keeping the column order
+type jsonOutput struct {
+	w       *bufio.Writer
+	columns [][]byte //Column names, JSON encoded
+	rows    int
+	started bool //The opening [ was written
+}
+
+func (j *jsonOutput) header(columns []string) error {
+	for _, c := range columns {
+		b, err := json.Marshal(c)
+		if err != nil {
+			return err
+		}
+		j.columns = append(j.columns, b)
+	}
+
+	j.started = true
+	_, err := j.w.WriteString("[")
+	return err
+}
+
+func (j *jsonOutput) row(values []interface{}) error {
+	if j.rows > 0 {
+		j.w.WriteString(",")
+	}
+	j.rows++
+
+	j.w.WriteString("\n  {")
+	for i, v := range values {
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			j.w.WriteString(", ")
+		}
+		j.w.Write(j.columns[i])
+		j.w.WriteString(": ")
+		j.w.Write(b)
+	}
+	_, err := j.w.WriteString("}")
+	return err
+}
+
+func (j *jsonOutput) flush() error {
+	if !j.started {
+		//No result set, e.g. the query failed before the header
+		j.w.WriteString("[")
+	}
+	if j.rows > 0 {
+		j.w.WriteString("\n")
+	}
+	j.w.WriteString("]\n")
+	return j.w.Flush()
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+//Pool settings used by Connect, and by Open when Config leaves them at 0
+const (
+	DefaultMaxOpenConns    = 20
+	DefaultMaxIdleConns    = 20
+	DefaultConnMaxLifetime = 3 * time.Minute //Below the usual server and proxy idle timeouts
+)
+
+//Config describes a database connection and its pool. Open builds the
+//DSN from it with the driver's own mysql.Config, so values never need
+//escaping by hand.
+type Config struct {
+	Host            string            //host or host:port (3306 when no port); 127.0.0.1:3306 when empty
+	User            string            //Required
+	Password        string            //Password for User
+	Database        string            //Default database (schema); none when empty
+	Params          map[string]string //Extra DSN parameters, e.g. system variables such as "sql_mode"
+	TLS             string            //"true", "skip-verify", "preferred", or a name registered with mysql.RegisterTLSConfig; no TLS when empty
+	Location        *time.Location    //Time zone DATETIME and TIMESTAMP values are read in with ParseTime; UTC when nil
+	ParseTime       bool              //Scan DATE, DATETIME and TIMESTAMP columns into time.Time
+	MultiStatements bool              //Allow several statements per Exec, as ExecList and batched ExecScript need
+	MaxOpenConns    int               //Most open connections; DefaultMaxOpenConns when 0, unlimited when negative
+	MaxIdleConns    int               //Most idle connections kept; DefaultMaxIdleConns when 0 (but at most MaxOpenConns), none when negative
+	ConnMaxLifetime time.Duration     //Connections are closed after this long; DefaultConnMaxLifetime when 0, never when negative
+	ConnMaxIdleTime time.Duration     //Idle connections are closed after this long; never when 0
+	InitStatements  []string          //Run on every new connection, e.g. "SET time_zone = '+00:00'"
+	OnConnect       ConnectHook       //Runs on every new connection, after InitStatements
+}
+
+//Validate reports the first problem with c, if any
+func (c Config) Validate() error {
+	switch {
+	case c.User == "":
+		return fmt.Errorf("config: User is required")
+	case c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns:
+		return fmt.Errorf("config: MaxIdleConns (%d) is more than MaxOpenConns (%d)", c.MaxIdleConns, c.MaxOpenConns)
+	case c.ConnMaxIdleTime < 0:
+		return fmt.Errorf("config: ConnMaxIdleTime is negative")
+	case c.ConnMaxLifetime > 0 && c.ConnMaxIdleTime > c.ConnMaxLifetime:
+		return fmt.Errorf("config: ConnMaxIdleTime (%v) is more than ConnMaxLifetime (%v)", c.ConnMaxIdleTime, c.ConnMaxLifetime)
+	}
+
+	for key := range c.Params {
+		if key == "" {
+			return fmt.Errorf("config: empty parameter name")
+		}
+	}
+
+	if _, err := mysql.ParseDSN(c.mysqlConfig().FormatDSN()); err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	return nil
+}
+
+//DSN returns the data source name for c, for use with sqlx.Open or
+//Connect. It contains the password. InitStatements and OnConnect can't
+//be expressed in a DSN; only Open applies them.
+func (c Config) DSN() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	return c.mysqlConfig().FormatDSN(), nil
+}
+
+//mysqlConfig is c as the driver's config, with the driver's defaults
+func (c Config) mysqlConfig() *mysql.Config {
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = c.Host
+	cfg.DBName = c.Database
+	cfg.TLSConfig = c.TLS
+	cfg.ParseTime = c.ParseTime
+	cfg.MultiStatements = c.MultiStatements
+
+	if c.Location != nil {
+		cfg.Loc = c.Location
+	}
+
+	if len(c.Params) > 0 {
+		cfg.Params = map[string]string{}
+		for k, v := range c.Params {
+			cfg.Params[k] = v
+		}
+	}
+
+	return cfg
+}
+
+//Open validates cfg and opens a DB with its pool settings and
+//connection hooks. Like Connect, it doesn't contact the server.
+func Open(cfg Config) (*DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	connector, err := mysql.NewConnector(cfg.mysqlConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	var hooks []ConnectHook
+	if len(cfg.InitStatements) > 0 {
+		hooks = append(hooks, ExecStatements(cfg.InitStatements...))
+	}
+	if cfg.OnConnect != nil {
+		hooks = append(hooks, cfg.OnConnect)
+	}
+	if len(hooks) > 0 {
+		connector = WithConnectHooks(connector, hooks...)
+	}
+
+	connection := sqlx.NewDb(sql.OpenDB(connector), "mysql")
+	cfg.applyPool(connection)
+
+	return New(connection), nil
+}
+
+//applyPool sets the pool limits of db from c, filling in the defaults
+func (c Config) applyPool(db *sqlx.DB) {
+	maxOpen := c.MaxOpenConns
+	switch {
+	case maxOpen == 0:
+		maxOpen = DefaultMaxOpenConns
+	case maxOpen < 0:
+		maxOpen = 0
+	}
+
+	//Negative keeps no idle connections, as database/sql does
+	maxIdle := c.MaxIdleConns
+	if maxIdle == 0 {
+		maxIdle = DefaultMaxIdleConns
+		if maxOpen > 0 && maxIdle > maxOpen {
+			maxIdle = maxOpen
+		}
+	}
+
+	lifetime := c.ConnMaxLifetime
+	switch {
+	case lifetime == 0:
+		lifetime = DefaultConnMaxLifetime
+	case lifetime < 0:
+		lifetime = 0
+	}
+
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(lifetime)
+	db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+}
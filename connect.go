@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+//DefaultConnectRetry is how ConnectContext and OpenContext retry. When
+//ctx has a deadline they retry until it passes, however many attempts
+//that takes; without one they stop after MaxAttempts, ten attempts over
+//roughly 20 seconds. Only connection errors are retried; a bad password
+//or unknown database fails right away.
+var DefaultConnectRetry = RetryPolicy{
+	MaxAttempts: 10,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	Retryable:   isConnectRetryable,
+}
+
+func isConnectRetryable(err error) bool {
+	return classify(err) == ErrConnection
+}
+
+//ConnectContext is Connect that also makes sure the server can be
+//reached, pinging it with DefaultConnectRetry until it answers, ctx's
+//deadline passes, or (with no deadline) the attempts run out. On
+//failure the DB is closed and the error says how long it tried.
+func ConnectContext(ctx context.Context, conn string) (*DB, error) {
+	db, err := Connect(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.waitReady(ctx); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+//OpenContext is Open that waits for the server like ConnectContext
+func OpenContext(ctx context.Context, cfg Config) (*DB, error) {
+	db, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.waitReady(ctx); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+//waitReady pings until the server answers, closing db if it never does
+func (db *DB) waitReady(ctx context.Context) error {
+	start := time.Now()
+	attempts := 0
+
+	policy := DefaultConnectRetry
+	if _, ok := ctx.Deadline(); ok {
+		policy.MaxAttempts = math.MaxInt32
+	}
+
+	err := policy.Do(ctx, func() error {
+		attempts++
+		err := db.Ready(ctx)
+		if err != nil {
+			db.Logger().Log(ctx, LevelWarn, "database not ready", "attempt", attempts, "error", err)
+		}
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("database not reachable after %d attempt(s) in %v: %w",
+			attempts, time.Since(start).Round(time.Millisecond), err)
+	}
+
+	return nil
+}
+
+//Ready pings the primary, opening a connection if none is idle, and
+//returns nil once the server answers; suitable for readiness probes.
+//Replicas aren't checked, since reads fall back to the primary.
+func (db *DB) Ready(ctx context.Context) error {
+	return queryError(db.DB.PingContext(ctx), "PING", nil)
+}
@@ -2,13 +2,13 @@ package database
 
 import (
 	//"fmt"
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"math"
 	"strings"
 
-	"github.com/bjbigler/utils"
 	"github.com/shopspring/decimal"
 
 	//Imported to initialize the sqlx package
@@ -19,16 +19,22 @@ import (
 //DB ...
 type DB struct {
 	*sqlx.DB
+	logger   Logger
+	server   serverInfo
+	replicas []*replica
+	policy   ReplicaPolicy
+	next     uint32 //Round-robin counter
 }
 
 //New ...
 func New(db *sqlx.DB) *DB {
 	// Configure any package-level settings
 	db = db.Unsafe()
-	return &DB{db}
+	return &DB{DB: db}
 }
 
-//Connect returns a database connection
+//Connect returns a database connection for the DSN conn, with the
+//default pool settings (see Config for more control)
 func Connect(conn string) (*DB, error) {
 	connection, err := sqlx.Open("mysql", conn)
 
@@ -36,6 +42,7 @@ func Connect(conn string) (*DB, error) {
 		return nil, err
 	}
 
+	Config{}.applyPool(connection)
 	db := New(connection)
 
 	return db, nil
@@ -48,278 +55,168 @@ type Named struct {
 	StructVal interface{}
 }
 
+//runner returns the helper implementation bound to the connection pool
+func (db *DB) runner() runner {
+	return runner{h: db.DB, log: db.Logger(), server: &db.server}
+}
+
 //ExecList takes a slice (list) of SQL commands
-//and executes them in batches of 200.
+//and executes them in batches of 200. It needs multiStatements=true
+//in the DSN; see ExecScript for running a script statement by statement.
 func (db *DB) ExecList(sqlList []string) (errors []error) {
-	if len(sqlList) == 0 {
-		return
-	}
-
-	//defer db.Close()
-
-	cnt := 0
-
-	sqlMultiStatement := ""
-
-	for _, sql := range sqlList {
-
-		cnt++
-
-		//Append semicolon to each string where missing
-		if !strings.HasSuffix(sql, ";") {
-			sql += ";"
-		}
-
-		sqlMultiStatement += sql
-
-		if cnt == 200 {
-			cnt = 0
-			_, err := db.Exec(sqlMultiStatement)
-			if err != nil {
-				utils.Log("Could not execute statement: " + sqlMultiStatement)
-				utils.Log(err)
-				errors = append(errors, err)
-			}
-
-			sqlMultiStatement = ""
-		}
-	}
-
-	//Execute remaining statements, if any
-	if sqlMultiStatement != "" {
-		_, err := db.Exec(sqlMultiStatement)
-		if err != nil {
-			utils.Log("Could not execute statement: " + sqlMultiStatement)
-			utils.Log(err)
-			errors = append(errors, err)
-		}
-	}
+	return db.ExecListContext(context.Background(), sqlList)
+}
 
-	return errors
+//ExecListContext is ExecList with a context.
+func (db *DB) ExecListContext(ctx context.Context, sqlList []string) (errors []error) {
+	return db.runner().execList(ctx, sqlList)
 }
 
 //ExecNamedList ...
 func (db *DB) ExecNamedList(namedList []*Named) []error {
-	//utils.Log("Starting exec named list")
-	var errors []error
-
-	// if len(namedList) > 20 {
-	// 	return []error{fmt.Errorf("more than 20 sql statements, aborting")}
-	// }
-
-	//db = sqlx.MustConnect("mysql", conn)
-	//defer db.Close()
-
-	//utils.Log(fmt.Sprintf("Executing %v statements", len(namedList)))
-	for _, s := range namedList {
-		_, err := db.NamedExec(s.SQL, s.StructVal)
-
-		if err != nil {
-			utils.Log(fmt.Sprintf("%v\n%v", err, s.SQL))
-			errors = append(errors, err)
-		}
-	}
-
-	if len(errors) > 0 {
-		return errors
-	}
-
-	return nil
+	return db.ExecNamedListContext(context.Background(), namedList)
+}
 
+//ExecNamedListContext is ExecNamedList with a context.
+func (db *DB) ExecNamedListContext(ctx context.Context, namedList []*Named) []error {
+	return db.runner().execNamedList(ctx, namedList)
 }
 
 //ExecNamedListAsTransaction ...
 func (db *DB) ExecNamedListAsTransaction(namedList []*Named) []error {
-	var errors []error
+	return db.ExecNamedListAsTransactionContext(context.Background(), namedList)
+}
 
+//ExecNamedListAsTransactionContext is ExecNamedListAsTransaction with a context.
+//The context is used to begin the transaction and for every statement in it.
+func (db *DB) ExecNamedListAsTransactionContext(ctx context.Context, namedList []*Named) []error {
 	if len(namedList) > 20 {
 		return []error{fmt.Errorf("more than 20 sql statements, aborting")}
 	}
 
-	//db = sqlx.MustConnect("mysql", conn)
-	//defer db.Close()
-
-	tx := db.MustBegin()
-
-	for _, s := range namedList {
-		_, err := tx.NamedExec(s.SQL, s.StructVal)
-
-		if err != nil {
-			tx.Rollback()
-			utils.Log(fmt.Sprintf("%v\n%v", err, s.SQL))
-			errors = append(errors, err)
-			return errors
+	err := db.WithTx(ctx, nil, func(tx *Tx) error {
+		for _, s := range namedList {
+			if _, err := tx.ExecNamedContext(ctx, s.SQL, s.StructVal); err != nil {
+				return err
+			}
 		}
-	}
-
-	err := tx.Commit()
+		return nil
+	})
 
 	if err != nil {
-		tx.Rollback()
-		utils.Log(err)
-		errors = append(errors, err)
-		return errors
+		return []error{err}
 	}
 
 	return nil
-
 }
 
 //ExecListAsTransaction executes a set of SQL statements in a transaction.
 //Statement count should not exceed 20.
 func (db *DB) ExecListAsTransaction(sql []string) error {
+	return db.ExecListAsTransactionContext(context.Background(), sql)
+}
+
+//ExecListAsTransactionContext is ExecListAsTransaction with a context.
+func (db *DB) ExecListAsTransactionContext(ctx context.Context, sql []string) error {
 	if len(sql) > 20 {
 		return fmt.Errorf("more than 20 sql statements, aborting")
 	}
 
-	//db = sqlx.MustConnect("mysql", conn)
-	//defer db.Close()
-
-	tx := db.MustBegin()
-
-	for _, s := range sql {
-		_, err := tx.Exec(s)
-
-		if err != nil {
-			tx.Rollback()
-			return err
+	return db.WithTx(ctx, nil, func(tx *Tx) error {
+		for _, s := range sql {
+			if _, err := tx.ExecSingleContext(ctx, s); err != nil {
+				return err
+			}
 		}
-	}
-
-	err := tx.Commit()
-
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
-
-	return nil
+		return nil
+	})
 }
 
 //GetRows ...
 func (db *DB) GetRows(parseRows func(*sqlx.Rows), sql string, sqlArgs ...interface{}) error {
+	return db.GetRowsContext(context.Background(), parseRows, sql, sqlArgs...)
+}
+
+//GetRowsContext is GetRows with a context. The query is cancelled
+//when ctx is done.
+func (db *DB) GetRowsContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, sqlArgs ...interface{}) error {
 
 	if db == nil {
 		return fmt.Errorf("db connection was nil")
 	}
 
-	if sql == "" {
-		return fmt.Errorf("SQL was blank")
-	}
-
-	// db, err := sqlx.Connect("mysql", conn)
-	// if err != nil {
-	// 	return err
-	// }
-
-	// defer db.Close()
-	// setConnections(db)
-
-	rows, err := db.Queryx(sql, sqlArgs...)
-	//Check the error before closing the rows!
-	if err != nil {
-		//utils.Log(fmt.Sprintf("%v\n%v", err, sql))
-		return fmt.Errorf("error GetRows(): %v", err)
-	}
-
-	if rows == nil {
-		//utils.Log(fmt.Sprintf("No rows returned with SQL: \n%s", sql))
-		return fmt.Errorf("no rows returned with SQL: %s", sql)
-	}
-
-	defer rows.Close()
-
-	parseRows(rows)
-
-	return err
+	return db.reader(ctx).getRows(ctx, parseRows, sql, sqlArgs...)
 }
 
 //GetRowsFromNamed is used mostly to filter rows by values in a "dummy" struct object.
-//The input SQL must contain SQL_CALC_FOUND_ROWS as its first value.
-func (db *DB) GetRowsFromNamed(parseRows func(*sqlx.Rows), sql string, arg interface{}) int {
-	// db = sqlx.MustConnect("mysql", conn)
-
-	// defer db.Close()
-	// setConnections(db)
-
-	rows, err := db.NamedQuery(sql, arg)
-	//Check error before closing rows!
-	if err != nil {
-		utils.Log(fmt.Sprintf("%v\n%v", err, sql))
-		panic(err)
-	}
-
-	defer rows.Close()
-
-	parseRows(rows)
-
-	return 0 //TODO: return row count
+//It returns the total number of rows the query matches ignoring its LIMIT,
+//for paging. The total comes from a generated SELECT COUNT(*) over the
+//query; SQL that still starts with the deprecated SQL_CALC_FOUND_ROWS
+//gets it from FOUND_ROWS() instead.
+func (db *DB) GetRowsFromNamed(parseRows func(*sqlx.Rows), sql string, arg interface{}) (total int, err error) {
+	return db.GetRowsFromNamedContext(context.Background(), parseRows, sql, arg)
+}
 
+//GetRowsFromNamedContext is GetRowsFromNamed with a context.
+func (db *DB) GetRowsFromNamedContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, arg interface{}) (total int, err error) {
+	return db.reader(ctx).getRowsFromNamed(ctx, parseRows, sql, arg)
 }
 
-//GetRowsInQuery requires that sql has an IN statement and array
+//GetRowsInQuery requires that sql has an IN statement and args
 //has the variables the IN statement can use.
-//Example: "SELECT * FROM table WHERE t_field IN (?)"
-//The "?" is replaced with the values in array.
+//Example: "SELECT * FROM table WHERE t_field IN (?) AND other = ? AND x IN (?)"
+//Each "?" matched by a slice in args is expanded to that many values;
+//other args are passed as they are. If any of the slices is empty the
+//query can't match, so it isn't run and parseRows isn't called.
 //See http://jmoiron.github.io/sqlx/
-func (db *DB) GetRowsInQuery(parseRows func(*sqlx.Rows), sql string, array interface{}) {
-
-	// db = sqlx.MustConnect("mysql", conn)
-	// defer db.Close()
-	// setConnections(db)
-
-	query, args, err := sqlx.In(sql, array)
-	if err != nil {
-		utils.Log(fmt.Sprintf("%v\n%v", err, sql))
-	}
-	query = db.Rebind(query)
-	rows, err := db.Queryx(query, args...)
-	//Check error before closing rows!
-	if err != nil {
-		utils.Log(fmt.Sprintf("%v\n%v", err, sql))
-		panic(err)
-	}
+func (db *DB) GetRowsInQuery(parseRows func(*sqlx.Rows), sql string, args ...interface{}) error {
+	return db.GetRowsInQueryContext(context.Background(), parseRows, sql, args...)
+}
 
-	defer rows.Close()
+//GetRowsInQueryContext is GetRowsInQuery with a context.
+func (db *DB) GetRowsInQueryContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, args ...interface{}) error {
+	return db.reader(ctx).getRowsInQuery(ctx, parseRows, sql, args...)
+}
 
-	parseRows(rows)
+//GetRowsInNamedQuery is GetRowsInQuery for :name parameters taken from arg,
+//a struct or map. Example: "SELECT * FROM table WHERE id IN (:ids) AND kind = :kind"
+func (db *DB) GetRowsInNamedQuery(parseRows func(*sqlx.Rows), sql string, arg interface{}) error {
+	return db.GetRowsInNamedQueryContext(context.Background(), parseRows, sql, arg)
+}
 
+//GetRowsInNamedQueryContext is GetRowsInNamedQuery with a context.
+func (db *DB) GetRowsInNamedQueryContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, arg interface{}) error {
+	return db.reader(ctx).getRowsInNamedQuery(ctx, parseRows, sql, arg)
 }
 
 //ExecNamed executes the query provided using the struct for values
 func (db *DB) ExecNamed(sql string, structVal interface{}) (sql.Result, error) {
+	return db.ExecNamedContext(context.Background(), sql, structVal)
+}
 
-	// db = sqlx.MustConnect("mysql", conn)
-	// defer db.Close()
-	// setConnections(db)
-
-	result, err := db.NamedExec(sql, structVal)
-
-	if err != nil {
-		utils.Log(fmt.Sprintf("Named exec error\nSQL:%v\nError: %v", sql, err))
-	}
-
-	return result, err
-
+//ExecNamedContext is ExecNamed with a context.
+func (db *DB) ExecNamedContext(ctx context.Context, sql string, structVal interface{}) (sql.Result, error) {
+	return db.runner().execNamed(ctx, sql, structVal)
 }
 
 //ExecSingle processes a single sql statement
 func (db *DB) ExecSingle(sql string, args ...interface{}) (sql.Result, error) {
-	// db = sqlx.MustConnect("mysql", conn)
-	// defer db.Close()
-	// setConnections(db)
+	return db.ExecSingleContext(context.Background(), sql, args...)
+}
 
-	result, err := db.Exec(sql, args...)
-	return result, err
+//ExecSingleContext is ExecSingle with a context.
+func (db *DB) ExecSingleContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return db.runner().exec(ctx, sql, args...)
 }
 
 //ExecPrepared ...
 func (db *DB) ExecPrepared(sql string, args ...interface{}) (sql.Result, error) {
-	// db = sqlx.MustConnect("mysql", conn)
-	// defer db.Close()
-	// setConnections(db)
+	return db.ExecPreparedContext(context.Background(), sql, args...)
+}
 
-	return db.Exec(sql, args...)
+//ExecPreparedContext is ExecPrepared with a context.
+func (db *DB) ExecPreparedContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return db.runner().exec(ctx, sql, args...)
 }
 
 //Prepared ...
@@ -328,16 +225,45 @@ type Prepared struct {
 	Args []interface{}
 }
 
-//ExecPreparedList ...
-func (db *DB) ExecPreparedList(statements []Prepared) {
+//PreparedResult is the outcome of one Prepared statement
+type PreparedResult struct {
+	Result sql.Result
+	Err    error
+}
 
-	// db = sqlx.MustConnect("mysql", conn)
-	// defer db.Close()
-	// setConnections(db)
+//ExecPreparedList executes each statement with its own args and returns
+//one PreparedResult per statement, in order. A failed statement does not
+//stop the ones after it. Consecutive statements with identical SQL
+//share a single prepared statement.
+func (db *DB) ExecPreparedList(statements []Prepared) []PreparedResult {
+	return db.ExecPreparedListContext(context.Background(), statements)
+}
 
-	for _, p := range statements {
-		db.MustExec(p.SQL, p.Args)
-	}
+//ExecPreparedListContext is ExecPreparedList with a context.
+func (db *DB) ExecPreparedListContext(ctx context.Context, statements []Prepared) []PreparedResult {
+	return db.runner().execPreparedList(ctx, statements, false)
+}
+
+//ExecPreparedListAsTransaction is ExecPreparedList inside a transaction.
+//Execution stops at the first failure and the transaction is rolled back;
+//the results then end with the failed statement, and its error is returned.
+func (db *DB) ExecPreparedListAsTransaction(statements []Prepared) ([]PreparedResult, error) {
+	return db.ExecPreparedListAsTransactionContext(context.Background(), statements)
+}
+
+//ExecPreparedListAsTransactionContext is ExecPreparedListAsTransaction with a context.
+func (db *DB) ExecPreparedListAsTransactionContext(ctx context.Context, statements []Prepared) ([]PreparedResult, error) {
+	var results []PreparedResult
+
+	err := db.WithTx(ctx, nil, func(tx *Tx) error {
+		results = tx.runner().execPreparedList(ctx, statements, true)
+		if n := len(results); n > 0 {
+			return results[n-1].Err
+		}
+		return nil
+	})
+
+	return results, err
 }
 
 //ToInt64ForStorage multiplies the input number by precision
@@ -387,29 +313,10 @@ func Sqlize(s string) string {
 //NOTE: *The field MUST be named "result" and MUST be coerceable into an int64.* If the
 //statment returns more than one row, only the first row is used.
 func (db *DB) Int64Scalar(sqlStr string, args ...interface{}) (int64, error) {
-
-	var result int64
-	var err error
-
-	// db = sqlx.MustConnect("mysql", conn)
-	// defer db.Close()
-	// setConnections(db)
-
-	row := db.QueryRow(sqlStr, args...)
-
-	switch err = row.Scan(&result); err {
-	case sql.ErrNoRows:
-		utils.Log("No rows in scalar")
-		return 0, fmt.Errorf("no rows returned")
-	case nil:
-		return result, nil
-	default:
-		utils.Log(err)
-		return 0, err
-	}
+	return db.Int64ScalarContext(context.Background(), sqlStr, args...)
 }
 
-// func setConnections(db *sqlx.DB) {
-// 	db.SetMaxOpenConns(20)
-// 	db.SetMaxIdleConns(20)
-// }
+//Int64ScalarContext is Int64Scalar with a context.
+func (db *DB) Int64ScalarContext(ctx context.Context, sqlStr string, args ...interface{}) (int64, error) {
+	return db.reader(ctx).int64Scalar(ctx, sqlStr, args...)
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//Errors that failed statements are classified as. Test for them with
+//errors.Is; the driver's *mysql.MySQLError is still reachable with errors.As.
+var (
+	ErrDuplicateKey        = errors.New("duplicate key")
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	ErrDeadlock            = errors.New("deadlock")
+	ErrLockTimeout         = errors.New("lock wait timeout")
+	ErrDataTooLong         = errors.New("data too long")
+	ErrConnection          = errors.New("connection error")
+)
+
+//ErrNotFound is returned by Get and Scalar when the query matches no rows
+var ErrNotFound = errors.New("not found")
+
+//mysqlErrors maps MySQL server error numbers to the errors above
+var mysqlErrors = map[uint16]error{
+	1022: ErrDuplicateKey,        //ER_DUP_KEY
+	1062: ErrDuplicateKey,        //ER_DUP_ENTRY
+	1586: ErrDuplicateKey,        //ER_DUP_ENTRY_WITH_KEY_NAME
+	1216: ErrForeignKeyViolation, //ER_NO_REFERENCED_ROW
+	1217: ErrForeignKeyViolation, //ER_ROW_IS_REFERENCED
+	1451: ErrForeignKeyViolation, //ER_ROW_IS_REFERENCED_2
+	1452: ErrForeignKeyViolation, //ER_NO_REFERENCED_ROW_2
+	1213: ErrDeadlock,            //ER_LOCK_DEADLOCK
+	1205: ErrLockTimeout,         //ER_LOCK_WAIT_TIMEOUT
+	1406: ErrDataTooLong,         //ER_DATA_TOO_LONG
+	1040: ErrConnection,          //ER_CON_COUNT_ERROR
+	1053: ErrConnection,          //ER_SERVER_SHUTDOWN
+	1152: ErrConnection,          //ER_ABORTING_CONNECTION
+	1158: ErrConnection,          //ER_NET_READ_ERROR
+	1159: ErrConnection,          //ER_NET_READ_INTERRUPTED
+	1160: ErrConnection,          //ER_NET_ERROR_ON_WRITE
+	1161: ErrConnection,          //ER_NET_WRITE_INTERRUPTED
+}
+
+//QueryError is returned by the DB and Tx helpers when a statement fails.
+//It carries the statement text but never the argument values.
+type QueryError struct {
+	SQL  string //Statement that failed
+	Args int    //Number of positional args passed with it
+	Kind error  //One of the Err... values above, or nil if unclassified
+	Err  error  //Error returned by the driver
+}
+
+func (e *QueryError) Error() string {
+	msg := fmt.Sprintf("%v [SQL: %s]", e.Err, compactSQL(e.SQL))
+	if e.Args > 0 {
+		msg += fmt.Sprintf(" [%d args redacted]", e.Args)
+	}
+	return msg
+}
+
+//Unwrap returns the driver error
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+//Is makes errors.Is(err, ErrDuplicateKey) and friends work
+func (e *QueryError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+//queryError wraps err, if not nil, in a *QueryError for sqlStr.
+//Errors that are already a *QueryError are returned unchanged.
+func queryError(err error, sqlStr string, args []interface{}) error {
+	if err == nil {
+		return nil
+	}
+
+	var qe *QueryError
+	if errors.As(err, &qe) {
+		return err
+	}
+
+	return &QueryError{SQL: sqlStr, Args: len(args), Kind: classify(err), Err: err}
+}
+
+//classify returns the Err... value matching err, or nil
+func classify(err error) error {
+	//Checked first: context.DeadlineExceeded implements net.Error, but a
+	//cancelled or timed out statement says nothing about the connection
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErrors[mysqlErr.Number]
+	}
+
+	var netErr net.Error
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &netErr) {
+		return ErrConnection
+	}
+
+	return nil
+}
+
+//compactSQL collapses whitespace and truncates long statements for error
+//messages and logs. It stops reading once the limit is reached, so huge
+//statements like bulk inserts cost no more than short ones.
+func compactSQL(sqlStr string) string {
+	const max = 1000
+
+	var b strings.Builder
+	space := false
+	for _, c := range sqlStr {
+		if unicode.IsSpace(c) {
+			space = b.Len() > 0
+			continue
+		}
+		if b.Len() >= max {
+			return b.String() + "..."
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
@@ -1,19 +1,186 @@
 package database
 
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//Operators accepted in Filter.Operator
+const (
+	OpEqual        = "="
+	OpNotEqual     = "<>"
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLike         = "LIKE"
+	OpIn           = "IN"
+	OpIsNull       = "IS NULL"
+	OpIsNotNull    = "IS NOT NULL"
+	OpBetween      = "BETWEEN"
+)
+
 //Filter used to construct WHERE clause
 type Filter struct {
-	Field       string //Struct field (convert to interface{} to hold field value, and then get db tag)
-	Value       string //Filter value
-	Conjunction string //Should be AND or OR
+	Field       string      //Column name; must match a db tag of the struct given to BuildWhere
+	Value       interface{} //Filter value; a slice for IN, a two-item slice for BETWEEN, ignored for IS (NOT) NULL
+	Operator    string      //One of the Op constants; "=" when blank
+	Conjunction string      //Should be AND or OR; joins this filter to the previous one (AND when blank)
+	Group       []*Filter   //When set, these filters are rendered in parentheses in place of Field/Value; skipped when empty
+}
+
+//BuildWhere turns filters into a parameterized WHERE clause (without the
+//WHERE keyword) and its args, e.g. "`name` = ? AND (`age` > ? OR `age` IS NULL)".
+//Every Field is checked against the db tags of structVal (a struct, pointer, or slice),
+//so user input can't name arbitrary columns. An empty filter list returns "1 = 1".
+func BuildWhere(filters []*Filter, structVal interface{}) (clause string, args []interface{}, err error) {
+	columns, err := Columns(structVal)
+	if err != nil {
+		return "", nil, err
+	}
+
+	allowed := map[string]bool{}
+	for _, c := range columns {
+		allowed[c] = true
+	}
+
+	clause, args, err = buildWhere(filters, allowed)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if clause == "" {
+		clause = "1 = 1"
+	}
+
+	return clause, args, nil
+}
+
+func buildWhere(filters []*Filter, allowed map[string]bool) (string, []interface{}, error) {
+	var sb strings.Builder
+	var args []interface{}
+
+	for i, f := range filters {
+		if f == nil {
+			continue
+		}
+
+		var condition string
+		var conditionArgs []interface{}
+		var err error
+		if f.Group != nil {
+			condition, conditionArgs, err = buildWhere(f.Group, allowed)
+			if err != nil {
+				return "", nil, err
+			}
+			//An empty group adds no condition, rather than one matching every row
+			if condition == "" {
+				continue
+			}
+			condition = "(" + condition + ")"
+		} else if condition, conditionArgs, err = f.condition(allowed); err != nil {
+			return "", nil, fmt.Errorf("filter %d: %v", i, err)
+		}
+
+		if sb.Len() > 0 {
+			conjunction := strings.ToUpper(strings.TrimSpace(f.Conjunction))
+			switch conjunction {
+			case "":
+				conjunction = "AND"
+			case "AND", "OR":
+			default:
+				return "", nil, fmt.Errorf("filter %d: invalid conjunction %q", i, f.Conjunction)
+			}
+			sb.WriteString(" " + conjunction + " ")
+		}
+
+		sb.WriteString(condition)
+		args = append(args, conditionArgs...)
+	}
+
+	return sb.String(), args, nil
+}
+
+//condition renders a single (non-group) filter
+func (f *Filter) condition(allowed map[string]bool) (string, []interface{}, error) {
+	if !allowed[f.Field] {
+		return "", nil, fmt.Errorf("unknown field %q", f.Field)
+	}
+	column := quoteIdentifier(f.Field)
+
+	operator := strings.ToUpper(strings.Join(strings.Fields(f.Operator), " "))
+	switch operator {
+	case "":
+		operator = OpEqual
+	case "!=":
+		operator = OpNotEqual
+	}
+
+	switch operator {
+	case OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpLike:
+		return column + " " + operator + " ?", []interface{}{f.Value}, nil
+
+	case OpIsNull, OpIsNotNull:
+		return column + " " + operator, nil, nil
+
+	case OpIn:
+		values, ok := sliceValues(f.Value)
+		if !ok {
+			return "", nil, fmt.Errorf("IN requires a slice, got %T", f.Value)
+		}
+		if len(values) == 0 {
+			//Nothing can be IN an empty list
+			return "1 = 0", nil, nil
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		return column + " IN (" + marks + ")", values, nil
+
+	case OpBetween:
+		values, ok := sliceValues(f.Value)
+		if !ok || len(values) != 2 {
+			return "", nil, fmt.Errorf("BETWEEN requires a slice of two values, got %v", f.Value)
+		}
+		return column + " BETWEEN ? AND ?", values, nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported operator %q", f.Operator)
+}
+
+//sliceValues spreads a slice or array into []interface{}. []byte and
+//driver.Valuer values are single values, not lists.
+func sliceValues(value interface{}) ([]interface{}, bool) {
+	if _, ok := value.(driver.Valuer); ok {
+		return nil, false
+	}
+	if _, ok := value.([]byte); ok {
+		return nil, false
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+
+	return values, true
 }
 
 //PrepWhere uses a slice of Filter to create a where clause
+//
+//Deprecated: PrepWhere puts values straight into the SQL text and ignores
+//Operator and Conjunction. Use BuildWhere.
 func PrepWhere(filters []*Filter) (result string) {
 
 	for _, f := range filters {
 
 		//TODO: need to check Field datatype and use quotes only when string or time
-		result += f.Field + " = '" + f.Value + "'"
+		result += f.Field + " = '" + fmt.Sprint(f.Value) + "'"
 	}
 
 	return result
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type filterRow struct {
+	Name string `db:"name"`
+	Age  int    `db:"age"`
+	Kind string `db:"kind"`
+}
+
+func TestBuildWhere(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []*Filter
+		clause  string
+		args    string
+	}{
+		{"no filters", nil, "1 = 1", "[]"},
+		{"equal by default", []*Filter{{Field: "name", Value: "bo"}}, "`name` = ?", "[bo]"},
+		{
+			"conjunctions and operators",
+			[]*Filter{
+				{Field: "name", Operator: "like", Value: "b%"},
+				{Field: "age", Operator: "!=", Value: 3, Conjunction: "or"},
+				{Field: "kind", Operator: "is  not null"},
+			},
+			"`name` LIKE ? OR `age` <> ? AND `kind` IS NOT NULL", "[b% 3]",
+		},
+		{"IN", []*Filter{{Field: "age", Operator: OpIn, Value: []int{1, 2}}}, "`age` IN (?, ?)", "[1 2]"},
+		{"empty IN", []*Filter{{Field: "age", Operator: OpIn, Value: []int{}}}, "1 = 0", "[]"},
+		{"BETWEEN", []*Filter{{Field: "age", Operator: OpBetween, Value: []int{1, 9}}}, "`age` BETWEEN ? AND ?", "[1 9]"},
+		{"[]byte is one value", []*Filter{{Field: "name", Value: []byte("x")}}, "`name` = ?", "[[120]]"},
+		{
+			"groups",
+			[]*Filter{
+				{Field: "kind", Value: "a"},
+				{Group: []*Filter{
+					{Field: "age", Operator: OpGreater, Value: 5},
+					{Field: "age", Operator: OpIsNull, Conjunction: "OR"},
+				}},
+			},
+			"`kind` = ? AND (`age` > ? OR `age` IS NULL)", "[a 5]",
+		},
+		{
+			"empty groups are skipped",
+			[]*Filter{
+				{Field: "kind", Value: "a"},
+				{Group: []*Filter{}, Conjunction: "OR"},
+				{Group: []*Filter{{Group: []*Filter{}}}, Conjunction: "OR"},
+			},
+			"`kind` = ?", "[a]",
+		},
+		{"only an empty group", []*Filter{{Group: []*Filter{}}}, "1 = 1", "[]"},
+	}
+
+	for _, tt := range tests {
+		clause, args, err := BuildWhere(tt.filters, filterRow{})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+		if clause != tt.clause {
+			t.Errorf("%s: clause = %q, want %q", tt.name, clause, tt.clause)
+		}
+		if got := fmt.Sprint(args); got != tt.args {
+			t.Errorf("%s: args = %s, want %s", tt.name, got, tt.args)
+		}
+	}
+}
+
+func TestBuildWhereErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []*Filter
+		want    string
+	}{
+		{"unknown field", []*Filter{{Field: "password", Value: 1}}, `unknown field "password"`},
+		{"injected field", []*Filter{{Field: "name = 1 OR 1", Value: 1}}, "unknown field"},
+		{"bad operator", []*Filter{{Field: "age", Operator: "; DROP", Value: 1}}, "unsupported operator"},
+		{"bad conjunction", []*Filter{{Field: "age", Value: 1}, {Field: "age", Value: 2, Conjunction: "XOR"}}, "invalid conjunction"},
+		{"IN without a slice", []*Filter{{Field: "age", Operator: OpIn, Value: 1}}, "IN requires a slice"},
+		{"BETWEEN with one value", []*Filter{{Field: "age", Operator: OpBetween, Value: []int{1}}}, "BETWEEN requires"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := BuildWhere(tt.filters, filterRow{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
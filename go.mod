@@ -1,6 +1,6 @@
 module github.com/bjbigler/database
 
-go 1.16
+go 1.18
 
 require (
 	github.com/PuerkitoBio/goquery v1.9.2 // indirect
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+//ReplicaProber checks a replica, returning how far it is behind the
+//primary, or an error if it can't serve reads
+type ReplicaProber interface {
+	Probe(ctx context.Context, replica *sqlx.DB) (lag time.Duration, err error)
+}
+
+//ReplicaProberFunc adapts an ordinary function to ReplicaProber
+type ReplicaProberFunc func(ctx context.Context, replica *sqlx.DB) (time.Duration, error)
+
+//Probe calls f
+func (f ReplicaProberFunc) Probe(ctx context.Context, replica *sqlx.DB) (time.Duration, error) {
+	return f(ctx, replica)
+}
+
+//HealthOptions tunes the replica health checker
+type HealthOptions struct {
+	Interval time.Duration //Time between checks; 5 seconds when 0
+	Timeout  time.Duration //Time allowed for each probe; 2 seconds when 0
+	MaxLag   time.Duration //Replicas further behind are taken out of rotation; 30 seconds when 0
+	Prober   ReplicaProber //How replicas are checked; StatusProber when nil
+}
+
+//ReplicaHealth is the result of a replica's last check
+type ReplicaHealth struct {
+	Index     int           //Position in the SetReplicas arguments
+	Healthy   bool          //In rotation
+	Lag       time.Duration //Replication lag at the last check
+	Err       error         //Why the last check failed, if it did
+	CheckedAt time.Time     //Zero until the first check
+}
+
+//StatusProber pings the replica and reads its lag from SHOW REPLICA STATUS,
+//falling back to SHOW SLAVE STATUS on servers older than MySQL 8.0.22.
+//A replica whose replication is stopped or not configured fails.
+var StatusProber ReplicaProber = ReplicaProberFunc(probeStatus)
+
+func probeStatus(ctx context.Context, replica *sqlx.DB) (time.Duration, error) {
+	if err := replica.PingContext(ctx); err != nil {
+		return 0, err
+	}
+
+	status, err := replicaStatus(ctx, replica, "SHOW REPLICA STATUS")
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == 1064 { //ER_PARSE_ERROR
+		status, err = replicaStatus(ctx, replica, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return 0, err
+	}
+	if status == nil {
+		return 0, fmt.Errorf("replication is not configured")
+	}
+
+	for _, column := range []string{"Seconds_Behind_Source", "Seconds_Behind_Master"} {
+		value, ok := status[column]
+		if !ok {
+			continue
+		}
+
+		b, _ := value.([]byte)
+		if b == nil {
+			return 0, fmt.Errorf("replication is not running")
+		}
+
+		seconds, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", column, err)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return 0, fmt.Errorf("replica status has no Seconds_Behind_Source column")
+}
+
+//replicaStatus returns the first row of a SHOW ... STATUS statement, or nil
+func replicaStatus(ctx context.Context, replica *sqlx.DB, query string) (map[string]interface{}, error) {
+	rows, err := replica.QueryxContext(ctx, query)
+	if err != nil {
+		return nil, queryError(err, query, nil)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, queryError(rows.Err(), query, nil)
+	}
+
+	status := map[string]interface{}{}
+	if err := rows.MapScan(status); err != nil {
+		return nil, queryError(err, query, nil)
+	}
+
+	return status, nil
+}
+
+//HeartbeatProber pings the replica and reads its lag from a heartbeat
+//table that a job on the primary updates every second or so, such as
+//pt-heartbeat's: the lag is the time since the newest value in column.
+//It works where SHOW REPLICA STATUS needs privileges the user lacks, and
+//also sees lag further up a replication chain.
+func HeartbeatProber(table, column string) ReplicaProber {
+	query := fmt.Sprintf("SELECT TIMESTAMPDIFF(MICROSECOND, MAX(%s), UTC_TIMESTAMP(6)) FROM %s",
+		quoteIdentifier(column), quoteIdentifier(table))
+
+	return ReplicaProberFunc(func(ctx context.Context, replica *sqlx.DB) (time.Duration, error) {
+		var micros *int64
+		if err := replica.QueryRowxContext(ctx, query).Scan(&micros); err != nil {
+			return 0, queryError(err, query, nil)
+		}
+		if micros == nil {
+			return 0, fmt.Errorf("heartbeat table %s is empty", table)
+		}
+		return time.Duration(*micros) * time.Microsecond, nil
+	})
+}
+
+//StartHealthCheck checks the replicas every opts.Interval in the
+//background, taking those that fail or lag more than opts.MaxLag out of
+//rotation and putting them back once they pass again. With every replica
+//out, reads go to the primary. The first check runs right away. Call stop
+//to end the checks; replicas keep their last state.
+func (db *DB) StartHealthCheck(opts HealthOptions) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			db.CheckReplicas(ctx, opts)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+//CheckReplicas runs one health check of every replica, concurrently,
+//and updates which are in rotation. StartHealthCheck calls it on a timer.
+func (db *DB) CheckReplicas(ctx context.Context, opts HealthOptions) {
+	prober := opts.Prober
+	if prober == nil {
+		prober = StatusProber
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	maxLag := opts.MaxLag
+	if maxLag <= 0 {
+		maxLag = 30 * time.Second
+	}
+
+	var wg sync.WaitGroup
+	for i, r := range db.replicas {
+		wg.Add(1)
+		go func(i int, r *replica) {
+			defer wg.Done()
+
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			lag, err := prober.Probe(probeCtx, r.db)
+			cancel()
+
+			if ctx.Err() != nil {
+				//Stopped mid-check; the result says nothing about the replica
+				return
+			}
+			if err == nil && lag > maxLag {
+				err = fmt.Errorf("lag %v exceeds %v", lag, maxLag)
+			}
+
+			if r.update(lag, err) {
+				if err != nil {
+					db.Logger().Log(ctx, LevelWarn, "replica ejected", "replica", i, "error", err)
+				} else {
+					db.Logger().Log(ctx, LevelInfo, "replica readmitted", "replica", i, "lag", lag)
+				}
+			}
+		}(i, r)
+	}
+	wg.Wait()
+}
+
+//ReplicaStatus returns the health of each replica, in SetReplicas order
+func (db *DB) ReplicaStatus() []ReplicaHealth {
+	status := make([]ReplicaHealth, len(db.replicas))
+	for i, r := range db.replicas {
+		r.mu.Lock()
+		status[i] = ReplicaHealth{Index: i, Healthy: r.healthy(), Lag: r.lag, Err: r.err, CheckedAt: r.checkedAt}
+		r.mu.Unlock()
+	}
+
+	return status
+}
+
+//healthy reports whether the replica is in rotation
+func (r *replica) healthy() bool {
+	return atomic.LoadInt32(&r.down) == 0
+}
+
+//update records a check and reports whether the replica left or
+//rejoined the rotation
+func (r *replica) update(lag time.Duration, err error) (changed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lag, r.err, r.checkedAt = lag, err, time.Now()
+
+	var down int32
+	if err != nil {
+		down = 1
+	}
+	return atomic.SwapInt32(&r.down, down) != down
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//stubConnector is a driver that never connects; the pools built on it
+//are only compared and asked for their stats
+type stubConnector struct{}
+
+func (stubConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("stub: no connections")
+}
+
+func (stubConnector) Driver() driver.Driver {
+	return nil
+}
+
+func stubDB() *sqlx.DB {
+	return sqlx.NewDb(sql.OpenDB(stubConnector{}), "mysql")
+}
+
+//probeResult is what the stub prober reports for a replica
+type probeResult struct {
+	lag time.Duration
+	err error
+}
+
+//stubProber reports results[replica], keyed by the replica's *sql.DB
+//since SetReplicas wraps each *sqlx.DB
+func stubProber(results map[*sql.DB]probeResult) ReplicaProber {
+	return ReplicaProberFunc(func(ctx context.Context, replica *sqlx.DB) (time.Duration, error) {
+		r := results[replica.DB]
+		return r.lag, r.err
+	})
+}
+
+func newReplicatedDB(t *testing.T, replicas int) (*DB, []*sqlx.DB) {
+	t.Helper()
+
+	db := New(stubDB())
+	db.SetLogger(nil)
+
+	var pools []*sqlx.DB
+	for i := 0; i < replicas; i++ {
+		pools = append(pools, stubDB())
+	}
+	db.SetReplicas(RoundRobin, pools...)
+
+	t.Cleanup(func() { db.Close() })
+
+	return db, pools
+}
+
+func healthy(db *DB) []bool {
+	var status []bool
+	for _, s := range db.ReplicaStatus() {
+		status = append(status, s.Healthy)
+	}
+	return status
+}
+
+func equalBools(a, b []bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCheckReplicasEjectsAndReadmits(t *testing.T) {
+	db, pools := newReplicatedDB(t, 3)
+	results := map[*sql.DB]probeResult{}
+	opts := HealthOptions{MaxLag: time.Second, Prober: stubProber(results)}
+
+	tests := []struct {
+		name    string
+		results []probeResult
+		want    []bool
+	}{
+		{"all pass", []probeResult{{}, {lag: time.Second}, {}}, []bool{true, true, true}},
+		{"lag above MaxLag", []probeResult{{lag: 2 * time.Second}, {}, {}}, []bool{false, true, true}},
+		{"probe error", []probeResult{{lag: 2 * time.Second}, {err: errors.New("down")}, {}}, []bool{false, false, true}},
+		{"readmitted", []probeResult{{}, {}, {}}, []bool{true, true, true}},
+	}
+
+	for _, tt := range tests {
+		for i, r := range tt.results {
+			results[pools[i].DB] = r
+		}
+
+		db.CheckReplicas(context.Background(), opts)
+
+		if got := healthy(db); !equalBools(got, tt.want) {
+			t.Errorf("%s: healthy = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	status := db.ReplicaStatus()
+	if status[1].Err != nil || status[1].CheckedAt.IsZero() {
+		t.Errorf("readmitted replica status = %+v, want a check without error", status[1])
+	}
+}
+
+func TestRoundRobinSkipsEjectedReplicas(t *testing.T) {
+	db, pools := newReplicatedDB(t, 3)
+	results := map[*sql.DB]probeResult{pools[1].DB: {err: errors.New("down")}}
+
+	db.CheckReplicas(context.Background(), HealthOptions{Prober: stubProber(results)})
+
+	seen := map[*sql.DB]int{}
+	for i := 0; i < 6; i++ {
+		seen[db.reader(context.Background()).h.(*sqlx.DB).DB]++
+	}
+
+	if seen[pools[1].DB] != 0 {
+		t.Errorf("ejected replica got %d reads", seen[pools[1].DB])
+	}
+	if seen[pools[0].DB] != 3 || seen[pools[2].DB] != 3 {
+		t.Errorf("reads = %d and %d, want 3 each", seen[pools[0].DB], seen[pools[2].DB])
+	}
+}
+
+func TestReadsFallBackToPrimary(t *testing.T) {
+	db, pools := newReplicatedDB(t, 2)
+	results := map[*sql.DB]probeResult{}
+	for _, p := range pools {
+		results[p.DB] = probeResult{err: errors.New("down")}
+	}
+
+	db.CheckReplicas(context.Background(), HealthOptions{Prober: stubProber(results)})
+
+	if h := db.reader(context.Background()).h; h != db.DB {
+		t.Errorf("with every replica out, reads went to %v, want the primary", h)
+	}
+
+	results[pools[0].DB] = probeResult{}
+	db.CheckReplicas(context.Background(), HealthOptions{Prober: stubProber(results)})
+
+	if h := db.reader(context.Background()).h.(*sqlx.DB); h.DB != pools[0].DB {
+		t.Errorf("after readmission, reads went to %v, want replica 0", h)
+	}
+}
+
+func TestUsePrimary(t *testing.T) {
+	db, _ := newReplicatedDB(t, 2)
+
+	if h := db.reader(UsePrimary(context.Background())).h; h != db.DB {
+		t.Errorf("UsePrimary read went to %v, want the primary", h)
+	}
+}
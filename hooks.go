@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+//ConnectHook sets up a new physical connection before the pool hands it
+//out, e.g. with SET statements. An error fails the connection: it is
+//closed and the error returned to whatever needed the connection.
+type ConnectHook func(ctx context.Context, conn *HookConn) error
+
+//HookConn is the new connection passed to a ConnectHook
+type HookConn struct {
+	conn driver.Conn
+}
+
+//Exec runs a statement on the connection
+func (c *HookConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		value, err := driver.DefaultParameterConverter.ConvertValue(arg)
+		if err != nil {
+			return queryError(err, query, args)
+		}
+		values[i] = driver.NamedValue{Ordinal: i + 1, Value: value}
+	}
+
+	err := driver.ErrSkip
+	if execer, ok := c.conn.(driver.ExecerContext); ok {
+		_, err = execer.ExecContext(ctx, query, values)
+	}
+
+	//The driver skips direct execution of statements with args unless
+	//interpolateParams is set; they go through a prepared statement
+	if errors.Is(err, driver.ErrSkip) {
+		err = c.execPrepared(ctx, query, values)
+	}
+
+	return queryError(err, query, args)
+}
+
+func (c *HookConn) execPrepared(ctx context.Context, query string, values []driver.NamedValue) error {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.conn.Prepare(query)
+	}
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if execer, ok := stmt.(driver.StmtExecContext); ok {
+		_, err = execer.ExecContext(ctx, values)
+		return err
+	}
+
+	plain := make([]driver.Value, len(values))
+	for i, v := range values {
+		plain[i] = v.Value
+	}
+	_, err = stmt.Exec(plain)
+	return err
+}
+
+//Driver returns the underlying driver connection, for hooks that need more than Exec
+func (c *HookConn) Driver() driver.Conn {
+	return c.conn
+}
+
+//ExecStatements returns a hook that runs statements in order, e.g.
+//"SET time_zone = '+00:00'" or "SET NAMES utf8mb4 COLLATE utf8mb4_0900_ai_ci"
+func ExecStatements(statements ...string) ConnectHook {
+	return func(ctx context.Context, conn *HookConn) error {
+		for _, s := range statements {
+			if err := conn.Exec(ctx, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+//WithConnectHooks wraps connector so that hooks run, in order, on every
+//connection it opens. Open the pool with sql.OpenDB and pass it to New
+//via sqlx.NewDb; Open does this for Config.InitStatements and OnConnect.
+func WithConnectHooks(connector driver.Connector, hooks ...ConnectHook) driver.Connector {
+	return hookConnector{Connector: connector, hooks: hooks}
+}
+
+type hookConnector struct {
+	driver.Connector
+	hooks []ConnectHook
+}
+
+func (c hookConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hc := &HookConn{conn: conn}
+	for _, hook := range c.hooks {
+		if err := hook(ctx, hc); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("connection setup failed: %w", err)
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//Iter streams the rows of a query one at a time, so result sets of any
+//size can be processed without loading them into memory. Rows are read
+//from the server only as fast as Next is called. Always Close an Iter;
+//until then it holds a connection (and, inside a transaction, blocks
+//other statements on it).
+//
+//	it, err := database.Iterate[User](ctx, db, "SELECT * FROM users")
+//	if err != nil { ... }
+//	defer it.Close()
+//	for it.Next() {
+//		user, err := it.Scan()
+//		...
+//	}
+//	if err := it.Err(); err != nil { ... }
+type Iter[T any] struct {
+	rows  *sqlx.Rows
+	query string
+	args  []interface{}
+	err   error
+}
+
+//Iterate runs query and returns an Iter over its rows. T follows the
+//same rules as in Select.
+func Iterate[T any](ctx context.Context, q Querier, query string, args ...interface{}) (*Iter[T], error) {
+	rows, err := q.reader(ctx).queryx(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Iter[T]{rows: rows, query: query, args: args}, nil
+}
+
+//Next advances to the next row. It returns false when the rows are
+//exhausted or an error occurred; check Err afterwards.
+func (it *Iter[T]) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	return it.rows.Next()
+}
+
+//Scan returns the current row as a T
+func (it *Iter[T]) Scan() (T, error) {
+	item, err := scanRow[T](it.rows)
+	if err != nil && it.err == nil {
+		it.err = queryError(err, it.query, it.args)
+	}
+
+	return item, it.err
+}
+
+//Err returns the first error met while iterating, including errors
+//the server or connection reported partway through the rows
+func (it *Iter[T]) Err() error {
+	if it.err == nil {
+		if err := it.rows.Err(); err != nil {
+			it.err = queryError(err, it.query, it.args)
+		}
+	}
+
+	return it.err
+}
+
+//Close releases the rows and their connection. It is safe to call
+//more than once, and to stop iterating early.
+func (it *Iter[T]) Close() error {
+	return it.rows.Close()
+}
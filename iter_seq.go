@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package database
+
+import (
+	"context"
+	"iter"
+)
+
+//Seq is Iterate as a range-over-func sequence. Each row comes with a
+//nil error; a failure ends the sequence with a zero T and the error.
+//Breaking out of the loop early closes the rows.
+//
+//	for user, err := range database.Seq[User](ctx, db, "SELECT * FROM users") {
+//		if err != nil { ... }
+//	}
+func Seq[T any](ctx context.Context, q Querier, query string, args ...interface{}) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		it, err := Iterate[T](ctx, q, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer it.Close()
+
+		for it.Next() {
+			item, err := it.Scan()
+			if !yield(item, err) || err != nil {
+				return
+			}
+		}
+
+		if err := it.Err(); err != nil {
+			yield(zero, err)
+		}
+	}
+}
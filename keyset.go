@@ -0,0 +1,310 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//SortColumn is one column of a keyset ordering
+type SortColumn struct {
+	Column string //Column name as returned by the query (its db tag)
+	Desc   bool   //Sort descending
+}
+
+//Keyset describes a query paginated by SelectKeyset
+type Keyset struct {
+	Query   string        //Base SELECT, without ORDER BY or LIMIT; its column names must be unique
+	Args    []interface{} //Args for Query
+	OrderBy []SortColumn  //Sort columns; the last must be unique (e.g. the primary key) and none may be NULL
+	Limit   int           //Page size
+}
+
+//KeysetPage is one page of a keyset query. Next and Prev are opaque,
+//URL-safe cursors to pass back to SelectKeyset; each is empty when
+//there is no page in that direction.
+type KeysetPage[T any] struct {
+	Items []T    `json:"items"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
+
+//SelectKeyset returns the page of ks that cursor points to, or the first
+//page when cursor is empty. Unlike LIMIT/OFFSET, each page is found with
+//a WHERE (a, b) > (?, ?) predicate on the sort columns, so deep pages cost
+//the same as the first given an index on them. T must be a struct (or
+//pointer to one) with db tags for every sort column. The query is wrapped
+//in a derived table, so its columns must have unique names: a join needs
+//aliases (b.id AS b_id) rather than a.*, b.* when both tables share a
+//column, or MySQL fails with ER_DUP_FIELDNAME.
+func SelectKeyset[T any](ctx context.Context, q Querier, ks Keyset, cursor string) (KeysetPage[T], error) {
+	var page KeysetPage[T]
+
+	if len(ks.OrderBy) == 0 {
+		return page, fmt.Errorf("keyset needs at least one sort column")
+	}
+	if ks.Limit <= 0 {
+		return page, fmt.Errorf("keyset limit must be positive")
+	}
+
+	backward := false
+	var keys []interface{}
+	if cursor != "" {
+		c, err := decodeCursor(cursor)
+		if err != nil {
+			return page, err
+		}
+		if len(c.Keys) != len(ks.OrderBy) {
+			return page, fmt.Errorf("cursor has %d keys, ordering has %d columns", len(c.Keys), len(ks.OrderBy))
+		}
+		backward = c.Backward
+		keys = c.Keys
+	}
+
+	query, args := keysetQuery(ks, keys, backward)
+
+	items, err := Select[T](ctx, q, query, args...)
+	if err != nil {
+		return page, err
+	}
+
+	more := len(items) > ks.Limit
+	if more {
+		items = items[:ks.Limit]
+	}
+
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	page.Items = items
+
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	//Going forward there is a previous page unless this is the first;
+	//coming back there is a next page, the one we came from.
+	hasNext, hasPrev := more, cursor != ""
+	if backward {
+		hasNext, hasPrev = true, more
+	}
+
+	if hasNext {
+		if page.Next, err = encodeCursor(items[len(items)-1], ks.OrderBy, false); err != nil {
+			return page, err
+		}
+	}
+	if hasPrev {
+		if page.Prev, err = encodeCursor(items[0], ks.OrderBy, true); err != nil {
+			return page, err
+		}
+	}
+
+	return page, nil
+}
+
+//keysetQuery wraps the base query with the keyset predicate, ordering and limit
+func keysetQuery(ks Keyset, keys []interface{}, backward bool) (string, []interface{}) {
+	args := append([]interface{}{}, ks.Args...)
+
+	var sb strings.Builder
+	sb.WriteString("SELECT * FROM (" + strings.TrimRight(strings.TrimSpace(ks.Query), ";") + ") AS keyset")
+
+	if keys != nil {
+		predicate, predicateArgs := keysetPredicate(ks.OrderBy, keys, backward)
+		sb.WriteString(" WHERE " + predicate)
+		args = append(args, predicateArgs...)
+	}
+
+	order := make([]string, len(ks.OrderBy))
+	for i, c := range ks.OrderBy {
+		order[i] = quoteIdentifier(c.Column)
+		if c.Desc != backward {
+			order[i] += " DESC"
+		}
+	}
+	sb.WriteString(" ORDER BY " + strings.Join(order, ", "))
+	sb.WriteString(" LIMIT " + strconv.Itoa(ks.Limit+1))
+
+	return sb.String(), args
+}
+
+//keysetPredicate selects the rows after (or, backward, before) keys.
+//When all columns sort the same way a row comparison is used:
+//(a, b) > (?, ?). Mixed directions expand to
+//a > ? OR (a = ? AND b < ?).
+func keysetPredicate(order []SortColumn, keys []interface{}, backward bool) (string, []interface{}) {
+	operator := func(c SortColumn) string {
+		if c.Desc != backward {
+			return "<"
+		}
+		return ">"
+	}
+
+	uniform := true
+	for _, c := range order {
+		uniform = uniform && c.Desc == order[0].Desc
+	}
+
+	if uniform {
+		columns := make([]string, len(order))
+		for i, c := range order {
+			columns[i] = quoteIdentifier(c.Column)
+		}
+		marks := strings.TrimSuffix(strings.Repeat("?, ", len(order)), ", ")
+		return "(" + strings.Join(columns, ", ") + ") " + operator(order[0]) + " (" + marks + ")", keys
+	}
+
+	var ors []string
+	var args []interface{}
+	for i, c := range order {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, quoteIdentifier(order[j].Column)+" = ?")
+			args = append(args, keys[j])
+		}
+		ands = append(ands, quoteIdentifier(c.Column)+" "+operator(c)+" ?")
+		args = append(args, keys[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+//keysetCursor is the decoded form of a cursor
+type keysetCursor struct {
+	Backward bool
+	Keys     []interface{}
+}
+
+//cursorKey is a key value with its type, so it decodes to what was encoded
+type cursorKey struct {
+	T string `json:"t"`
+	V string `json:"v"`
+}
+
+type cursorJSON struct {
+	B bool        `json:"b,omitempty"`
+	K []cursorKey `json:"k"`
+}
+
+//encodeCursor reads the sort column values from item and encodes them
+func encodeCursor(item interface{}, order []SortColumn, backward bool) (string, error) {
+	v := reflect.ValueOf(item)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return "", fmt.Errorf("keyset rows must be structs, got %T", item)
+	}
+
+	byColumn := map[string]dbField{}
+	for _, f := range dbFields(v.Type()) {
+		byColumn[f.Column] = f
+	}
+
+	c := cursorJSON{B: backward}
+	for _, col := range order {
+		f, ok := byColumn[col.Column]
+		if !ok {
+			return "", fmt.Errorf("%v has no field for sort column %q", v.Type(), col.Column)
+		}
+
+		key, err := encodeKey(fieldValue(v, f.Index).Interface())
+		if err != nil {
+			return "", fmt.Errorf("sort column %q: %v", col.Column, err)
+		}
+		c.K = append(c.K, key)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func encodeKey(value interface{}) (cursorKey, error) {
+	value, err := driverValue(value)
+	if err != nil {
+		return cursorKey{}, err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return cursorKey{}, fmt.Errorf("value is NULL")
+	case string:
+		return cursorKey{T: "s", V: v}, nil
+	case []byte:
+		return cursorKey{T: "s", V: string(v)}, nil
+	case time.Time:
+		return cursorKey{T: "t", V: v.Format(time.RFC3339Nano)}, nil
+	case bool:
+		return cursorKey{T: "b", V: strconv.FormatBool(v)}, nil
+	case float32, float64:
+		return cursorKey{T: "f", V: fmt.Sprint(v)}, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorKey{T: "i", V: strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorKey{T: "u", V: strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.String:
+		return cursorKey{T: "s", V: rv.String()}, nil
+	}
+
+	return cursorKey{}, fmt.Errorf("unsupported type %T", value)
+}
+
+func decodeCursor(cursor string) (keysetCursor, error) {
+	var c keysetCursor
+
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor: %v", err)
+	}
+
+	var raw cursorJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return c, fmt.Errorf("invalid cursor: %v", err)
+	}
+
+	c.Backward = raw.B
+	for _, k := range raw.K {
+		var value interface{}
+
+		switch k.T {
+		case "s":
+			value, err = k.V, nil
+		case "i":
+			value, err = strconv.ParseInt(k.V, 10, 64)
+		case "u":
+			value, err = strconv.ParseUint(k.V, 10, 64)
+		case "f":
+			value, err = strconv.ParseFloat(k.V, 64)
+		case "b":
+			value, err = strconv.ParseBool(k.V)
+		case "t":
+			value, err = time.Parse(time.RFC3339Nano, k.V)
+		default:
+			err = fmt.Errorf("unknown key type %q", k.T)
+		}
+
+		if err != nil {
+			return c, fmt.Errorf("invalid cursor: %v", err)
+		}
+		c.Keys = append(c.Keys, value)
+	}
+
+	return c, nil
+}
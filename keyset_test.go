@@ -0,0 +1,101 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeysetPredicate(t *testing.T) {
+	keys := []interface{}{"b", 7}
+
+	tests := []struct {
+		name     string
+		order    []SortColumn
+		backward bool
+		want     string
+		args     string
+	}{
+		{"ascending", []SortColumn{{Column: "name"}, {Column: "id"}}, false, "(`name`, `id`) > (?, ?)", "[b 7]"},
+		{"ascending backward", []SortColumn{{Column: "name"}, {Column: "id"}}, true, "(`name`, `id`) < (?, ?)", "[b 7]"},
+		{"descending", []SortColumn{{Column: "name", Desc: true}, {Column: "id", Desc: true}}, false, "(`name`, `id`) < (?, ?)", "[b 7]"},
+		{
+			"mixed directions", []SortColumn{{Column: "name", Desc: true}, {Column: "id"}}, false,
+			"((`name` < ?) OR (`name` = ? AND `id` > ?))", "[b b 7]",
+		},
+		{
+			"mixed directions backward", []SortColumn{{Column: "name", Desc: true}, {Column: "id"}}, true,
+			"((`name` > ?) OR (`name` = ? AND `id` < ?))", "[b b 7]",
+		},
+	}
+
+	for _, tt := range tests {
+		got, args := keysetPredicate(tt.order, keys, tt.backward)
+		if got != tt.want {
+			t.Errorf("%s: predicate = %q, want %q", tt.name, got, tt.want)
+		}
+		if fmt.Sprint(args) != tt.args {
+			t.Errorf("%s: args = %v, want %s", tt.name, args, tt.args)
+		}
+	}
+}
+
+type keysetRow struct {
+	Name    string    `db:"name"`
+	ID      uint64    `db:"id"`
+	Score   float64   `db:"score"`
+	Active  bool      `db:"active"`
+	Created time.Time `db:"created"`
+	Rank    int8      `db:"rank"`
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	row := keysetRow{Name: "ann", ID: 42, Score: 1.5, Active: true, Created: time.Date(2024, 3, 1, 12, 0, 0, 123000, time.UTC), Rank: -3}
+	order := []SortColumn{{Column: "name"}, {Column: "id"}, {Column: "score"}, {Column: "active"}, {Column: "created"}, {Column: "rank"}}
+
+	cursor, err := encodeCursor(row, order, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []interface{}{"ann", uint64(42), 1.5, true, row.Created, int64(-3)}
+	if !c.Backward || !reflect.DeepEqual(c.Keys, want) {
+		t.Errorf("decoded %+v, want backward keys %v", c, want)
+	}
+}
+
+func TestDecodeCursorErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor string
+		want   string
+	}{
+		{"not base64", "!!!", "invalid cursor"},
+		{"not JSON", "bm90IGpzb24", "invalid cursor"},
+		{"unknown key type", "eyJrIjpbeyJ0IjoieCIsInYiOiIxIn1dfQ", `unknown key type "x"`},
+		{"bad integer", "eyJrIjpbeyJ0IjoiaSIsInYiOiJhIn1dfQ", "invalid cursor"},
+	}
+
+	for _, tt := range tests {
+		_, err := decodeCursor(tt.cursor)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestEncodeKeyNilValuer(t *testing.T) {
+	var name *sql.NullString
+
+	if _, err := encodeKey(name); err == nil || !strings.Contains(err.Error(), "NULL") {
+		t.Errorf("error = %v, want one about NULL", err)
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bjbigler/utils"
+)
+
+//Level is the severity of a log event. The values match log/slog's levels.
+type Level int
+
+//Log levels
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+//Logger receives the events logged by DB and Tx. args are alternating
+//key/value pairs in the style of log/slog; statement events carry
+//"query", "duration", and, when known, "rows" and "error".
+//Argument values are never logged. See SetLogger.
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, args ...interface{})
+}
+
+//LoggerFunc adapts an ordinary function to Logger
+type LoggerFunc func(ctx context.Context, level Level, msg string, args ...interface{})
+
+//Log calls f
+func (f LoggerFunc) Log(ctx context.Context, level Level, msg string, args ...interface{}) {
+	f(ctx, level, msg, args...)
+}
+
+//NopLogger discards all events
+var NopLogger Logger = LoggerFunc(func(context.Context, Level, string, ...interface{}) {})
+
+//utilsLogger is the default Logger. It writes warnings and errors
+//through utils.Log, which is where this package always logged to.
+type utilsLogger struct{}
+
+func (utilsLogger) Log(ctx context.Context, level Level, msg string, args ...interface{}) {
+	if level < LevelWarn {
+		return
+	}
+
+	utils.Log(formatEvent(level, msg, args))
+}
+
+//formatEvent renders an event as a single line: LEVEL msg key=value ...
+func formatEvent(level Level, msg string, args []interface{}) string {
+	var sb strings.Builder
+	sb.WriteString(level.String() + " " + msg)
+
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&sb, " %v=%v", args[i], args[i+1])
+		} else {
+			fmt.Fprintf(&sb, " %v", args[i])
+		}
+	}
+
+	return sb.String()
+}
+
+//SetLogger sends the DB's log events, and those of transactions started
+//from it, to l. A nil l silences logging. By default warnings and errors
+//go to utils.Log. SetLogger is meant to be called once, before the DB is
+//in use.
+func (db *DB) SetLogger(l Logger) {
+	if l == nil {
+		l = NopLogger
+	}
+	db.logger = l
+}
+
+//Logger returns the DB's logger
+func (db *DB) Logger() Logger {
+	if db.logger == nil {
+		return utilsLogger{}
+	}
+	return db.logger
+}
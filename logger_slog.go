@@ -0,0 +1,22 @@
+//go:build go1.21
+
+package database
+
+import (
+	"context"
+	"log/slog"
+)
+
+//SlogLogger returns a Logger that writes to l, e.g.
+//db.SetLogger(database.SlogLogger(slog.Default())).
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Log(ctx context.Context, level Level, msg string, args ...interface{}) {
+	s.l.Log(ctx, slog.Level(level), msg, args...)
+}
@@ -0,0 +1,428 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+//DefaultMigrationTable is where a Migrator records applied migrations
+//unless Migrator.Table is set
+const DefaultMigrationTable = "schema_migrations"
+
+//migrationFile matches migration file names: 0001_create_users.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+//Migration is one versioned schema change, read from a pair of files
+//named NNNN_name.up.sql and NNNN_name.down.sql
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string //SQL of the .up.sql file
+	Down     string //SQL of the .down.sql file; empty if there is none
+	Checksum string //SHA-256 of Up, hex encoded
+}
+
+//MigrationStep is a migration applied or reverted by Up, Down or Goto
+type MigrationStep struct {
+	Version int64
+	Name    string
+	Up      bool   //True when applying, false when reverting
+	SQL     string //Script that runs
+}
+
+//MigrationStatus is the state of one migration, as reported by Status
+type MigrationStatus struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time //Zero unless applied
+	Modified  bool      //Applied, but its .up.sql changed since
+	Missing   bool      //Applied, but there is no file for it any more
+}
+
+//Migrator applies versioned migrations to a database. Applied versions
+//and the checksums of their .up.sql files are kept in Table, and a
+//GET_LOCK advisory lock makes sure only one Migrator runs at a time per
+//database. MySQL commits DDL implicitly, so a migration that fails
+//halfway is not rolled back; keep migrations to one DDL statement where
+//possible.
+type Migrator struct {
+	Table       string        //Version table; DefaultMigrationTable when empty
+	LockTimeout time.Duration //How long to wait for another Migrator to finish; 1 minute when 0
+	DryRun      bool          //Report the steps Up, Down and Goto would run without running them
+
+	db         *DB
+	migrations []Migration //Sorted by version
+}
+
+//NewMigrator reads the migrations in the root of fsys, e.g. an embed.FS
+//narrowed with fs.Sub. Files not named like migrations are ignored.
+//Every version needs an .up.sql file; .down.sql files are optional, but
+//a migration without one can't be reverted.
+func NewMigrator(db *DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	hasUp := map[int64]bool{}
+	for _, e := range entries {
+		match := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("%s: invalid migration version", e.Name())
+		}
+
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := SplitScript(string(b)); err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(b)
+			hasUp[version] = true
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	migrator := &Migrator{db: db}
+	for _, m := range byVersion {
+		if !hasUp[m.Version] {
+			return nil, fmt.Errorf("migration %d (%s) has no .up.sql file", m.Version, m.Name)
+		}
+
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+//Migrations returns the migrations read from the files, by version
+func (m *Migrator) Migrations() []Migration {
+	return append([]Migration{}, m.migrations...)
+}
+
+//Up applies every migration not applied yet, in version order
+func (m *Migrator) Up(ctx context.Context) ([]MigrationStep, error) {
+	return m.migrate(ctx, func(applied map[int64]appliedMigration) ([]MigrationStep, error) {
+		var steps []MigrationStep
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok {
+				steps = append(steps, MigrationStep{Version: mig.Version, Name: mig.Name, Up: true, SQL: mig.Up})
+			}
+		}
+		return steps, nil
+	})
+}
+
+//Down reverts the n most recently applied migrations (by version).
+//Down(ctx, 0) does nothing; a negative n is an error.
+func (m *Migrator) Down(ctx context.Context, n int) ([]MigrationStep, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("can't revert %d migrations", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	return m.migrate(ctx, func(applied map[int64]appliedMigration) ([]MigrationStep, error) {
+		versions := appliedVersions(applied)
+		if n < len(versions) {
+			versions = versions[:n]
+		}
+		return m.downSteps(applied, versions)
+	})
+}
+
+//Goto migrates up or down to version: migrations after it are reverted,
+//newest first, then those up to it that aren't applied are applied.
+//Goto(ctx, 0) reverts everything.
+func (m *Migrator) Goto(ctx context.Context, version int64) ([]MigrationStep, error) {
+	known := version == 0
+	for _, mig := range m.migrations {
+		known = known || mig.Version == version
+	}
+	if !known {
+		return nil, fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.migrate(ctx, func(applied map[int64]appliedMigration) ([]MigrationStep, error) {
+		var versions []int64
+		for _, v := range appliedVersions(applied) {
+			if v > version {
+				versions = append(versions, v)
+			}
+		}
+
+		steps, err := m.downSteps(applied, versions)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+				steps = append(steps, MigrationStep{Version: mig.Version, Name: mig.Name, Up: true, SQL: mig.Up})
+			}
+		}
+		return steps, nil
+	})
+}
+
+//Status lists every migration, from the files and the version table, by version
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(ctx, m.db.runner())
+	if err != nil {
+		return nil, err
+	}
+
+	var status []MigrationStatus
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.appliedAt()
+			s.Modified = a.Checksum != mig.Checksum
+		}
+		status = append(status, s)
+	}
+
+	for _, a := range applied {
+		if m.find(a.Version) == nil {
+			status = append(status, MigrationStatus{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.appliedAt(), Missing: true})
+		}
+	}
+
+	sort.Slice(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+
+	return status, nil
+}
+
+//appliedMigration is a row of the version table
+type appliedMigration struct {
+	Version   int64   `db:"version"`
+	Name      string  `db:"name"`
+	Checksum  string  `db:"checksum"`
+	AppliedAt float64 `db:"applied_at"` //Unix time, so it scans without parseTime in the DSN
+}
+
+func (a appliedMigration) appliedAt() time.Time {
+	sec := int64(a.AppliedAt)
+	return time.Unix(sec, int64((a.AppliedAt-float64(sec))*1e9))
+}
+
+//appliedVersions returns the applied versions, newest first
+func appliedVersions(applied map[int64]appliedMigration) []int64 {
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	return versions
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+//downSteps reverts versions in the order given
+func (m *Migrator) downSteps(applied map[int64]appliedMigration, versions []int64) ([]MigrationStep, error) {
+	var steps []MigrationStep
+	for _, v := range versions {
+		mig := m.find(v)
+		if mig == nil {
+			return nil, fmt.Errorf("migration %d (%s) is applied but has no files", v, applied[v].Name)
+		}
+		if mig.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no .down.sql file", v, mig.Name)
+		}
+		steps = append(steps, MigrationStep{Version: mig.Version, Name: mig.Name, SQL: mig.Down})
+	}
+
+	return steps, nil
+}
+
+func (m *Migrator) table() string {
+	if m.Table == "" {
+		return quoteIdentifier(DefaultMigrationTable)
+	}
+	return quoteIdentifier(m.Table)
+}
+
+//migrate takes the lock, plans the steps from the applied migrations,
+//and runs them. On failure the steps that completed are returned.
+func (m *Migrator) migrate(ctx context.Context, plan func(map[int64]appliedMigration) ([]MigrationStep, error)) ([]MigrationStep, error) {
+	r, unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if !m.DryRun {
+		if _, err := r.execContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.table()+` (
+			version BIGINT NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum CHAR(64) NOT NULL,
+			applied_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6)
+		)`); err != nil {
+			return nil, err
+		}
+	}
+
+	applied, err := m.applied(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range applied {
+		if mig := m.find(a.Version); mig != nil && mig.Checksum != a.Checksum {
+			return nil, fmt.Errorf("migration %d (%s) was modified after it was applied", a.Version, a.Name)
+		}
+	}
+
+	steps, err := plan(applied)
+	if err != nil || m.DryRun {
+		return steps, err
+	}
+
+	for i, step := range steps {
+		if err := m.run(ctx, r, step); err != nil {
+			return steps[:i], err
+		}
+	}
+
+	return steps, nil
+}
+
+//run applies or reverts one migration and records it in the version table
+func (m *Migrator) run(ctx context.Context, r runner, step MigrationStep) error {
+	start := time.Now()
+
+	direction := "down"
+	if step.Up {
+		direction = "up"
+	}
+	file := fmt.Sprintf("%d_%s.%s.sql", step.Version, step.Name, direction)
+
+	statements, err := SplitScript(step.SQL)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file, err)
+	}
+	if errs := r.execStatements(ctx, scriptFile{name: file, statements: statements}, ScriptOptions{}); len(errs) > 0 {
+		return errs[0]
+	}
+
+	if step.Up {
+		_, err = r.execContext(ctx, "INSERT INTO "+m.table()+" (version, name, checksum) VALUES (?, ?, ?)",
+			step.Version, step.Name, m.find(step.Version).Checksum)
+	} else {
+		_, err = r.execContext(ctx, "DELETE FROM "+m.table()+" WHERE version = ?", step.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	r.log.Log(ctx, LevelInfo, "migration "+direction, "version", step.Version, "name", step.Name, "duration", time.Since(start))
+
+	return nil
+}
+
+//applied reads the version table. A missing table means nothing is applied.
+func (m *Migrator) applied(ctx context.Context, r runner) (map[int64]appliedMigration, error) {
+	applied := map[int64]appliedMigration{}
+
+	rows, err := r.queryx(ctx, "SELECT version, name, checksum, UNIX_TIMESTAMP(applied_at) AS applied_at FROM "+m.table())
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == 1146 { //ER_NO_SUCH_TABLE
+			return applied, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.StructScan(&a); err != nil {
+			return nil, err
+		}
+		applied[a.Version] = a
+	}
+
+	return applied, rows.Err()
+}
+
+//lockName is the advisory lock, scoped to the current database since
+//GET_LOCK names are server wide
+const lockName = "CONCAT(COALESCE(DATABASE(), ''), '.', ?)"
+
+//lock pins a connection and takes the migration lock on it. unlock
+//releases the lock and the connection.
+func (m *Migrator) lock(ctx context.Context) (r runner, unlock func(), err error) {
+	r, release, err := m.db.runner().pin(ctx)
+	if err != nil {
+		return r, nil, err
+	}
+
+	timeout := m.LockTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+
+	//GET_LOCK takes whole seconds, and 0 wouldn't wait at all
+	seconds := int64((timeout + time.Second - 1) / time.Second)
+
+	got, err := r.int64Scalar(ctx, "SELECT GET_LOCK("+lockName+", ?)", m.table(), seconds)
+	if err == nil && got != 1 {
+		err = fmt.Errorf("timed out after %v waiting for another migration to finish", timeout)
+	}
+	if err != nil {
+		release()
+		return r, nil, err
+	}
+
+	return r, func() {
+		//Not ctx: the lock must be released even if it was cancelled,
+		//or it stays held by the pooled connection
+		r.int64Scalar(context.Background(), "SELECT RELEASE_LOCK("+lockName+")", m.table())
+		release()
+	}, nil
+}
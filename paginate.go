@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+)
+
+//Page sizes used by Paginate
+var (
+	DefaultPageSize = 25  //Used when the requested size is less than 1
+	MaxPageSize     = 500 //Larger requested sizes are reduced to this
+)
+
+//Page is one page of a query run by Paginate, ready to be sent
+//to a front end as JSON
+type Page[T any] struct {
+	Items   []T   `json:"items"`
+	Total   int64 `json:"total"`   //Rows matched by the query over all pages
+	Page    int   `json:"page"`    //This page's number, from 1
+	Size    int   `json:"size"`    //Page size actually used
+	Pages   int   `json:"pages"`   //Number of pages
+	HasNext bool  `json:"hasNext"` //Page < Pages
+}
+
+//Paginate runs query for page number page (from 1) of size rows, along
+//with a COUNT(*) over the same query for the totals. query must not end in
+//its own LIMIT (one is replaced if present). page is raised to 1 and size
+//bounded by DefaultPageSize and MaxPageSize. Asking past the last page
+//returns no items but still reports the totals. T follows the rules of
+//Select.
+func Paginate[T any](ctx context.Context, q Querier, query string, args []interface{}, page, size int) (Page[T], error) {
+	if page < 1 {
+		page = 1
+	}
+	if size < 1 {
+		size = DefaultPageSize
+	}
+	if size > MaxPageSize {
+		size = MaxPageSize
+	}
+
+	result := Page[T]{Items: []T{}, Page: page, Size: size}
+
+	query, args = stripLimit(query, args)
+
+	countSQL, countArgs := countQuery(query, args)
+	total, err := Scalar[int64](ctx, q, countSQL, countArgs...)
+	if err != nil {
+		return result, err
+	}
+
+	result.Total = total
+	result.Pages = int((total + int64(size) - 1) / int64(size))
+	result.HasNext = page < result.Pages
+
+	offset := int64(page-1) * int64(size)
+	if offset >= total {
+		return result, nil
+	}
+
+	pageArgs := append(append([]interface{}{}, args...), size, offset)
+	if result.Items, err = Select[T](ctx, q, query+" LIMIT ? OFFSET ?", pageArgs...); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//ReplicaPolicy chooses the replica each read goes to
+type ReplicaPolicy int
+
+const (
+	RoundRobin       ReplicaPolicy = iota //Each replica in turn
+	LeastConnections                      //The replica with the fewest connections in use
+)
+
+//replica is a read replica's connection pool and its health
+type replica struct {
+	db   *sqlx.DB
+	down int32 //1 while out of rotation, set by the health checker
+
+	mu        sync.Mutex
+	lag       time.Duration
+	err       error
+	checkedAt time.Time
+}
+
+//SetReplicas makes the DB send reads to replicas, chosen by policy:
+//GetRows, GetRowsFromNamed, GetRowsInQuery, GetRowsInNamedQuery,
+//Int64Scalar, and the generic helpers (Select, Get, Scalar, Iterate,
+//Paginate, SelectKeyset, SelectIn). Everything else, including
+//transactions and the methods of the embedded *sqlx.DB, uses the primary.
+//Use UsePrimary for reads that must see the caller's own writes, and
+//StartHealthCheck to take failing or lagging replicas out of rotation.
+//SetReplicas with no replicas sends everything to the primary again. Like
+//SetLogger, it is meant to be called once, before the DB is in use.
+func (db *DB) SetReplicas(policy ReplicaPolicy, replicas ...*sqlx.DB) {
+	db.policy = policy
+	db.replicas = nil
+	for _, r := range replicas {
+		db.replicas = append(db.replicas, &replica{db: r.Unsafe()})
+	}
+}
+
+//Close closes the primary and every replica
+func (db *DB) Close() error {
+	err := db.DB.Close()
+	for _, r := range db.replicas {
+		if rErr := r.db.Close(); err == nil {
+			err = rErr
+		}
+	}
+	return err
+}
+
+type primaryKey struct{}
+
+//UsePrimary returns a context that sends reads made with it to the
+//primary, e.g. to read back a row just written
+func UsePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+//reader returns the runner reads made with ctx should use: a replica,
+//or the primary when there are none or ctx came from UsePrimary
+func (db *DB) reader(ctx context.Context) runner {
+	r := db.runner()
+	if forced, _ := ctx.Value(primaryKey{}).(bool); forced {
+		return r
+	}
+
+	if rep := db.pickReplica(); rep != nil {
+		r.h = rep.db
+	}
+	return r
+}
+
+//pickReplica returns the replica to use under the DB's policy, or nil
+//when no replica is in rotation
+func (db *DB) pickReplica() *replica {
+	healthy := make([]*replica, 0, len(db.replicas))
+	for _, r := range db.replicas {
+		if r.healthy() {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return nil
+	}
+
+	if db.policy == LeastConnections {
+		best, inUse := healthy[0], healthy[0].db.Stats().InUse
+		for _, r := range healthy[1:] {
+			if n := r.db.Stats().InUse; n < inUse {
+				best, inUse = r, n
+			}
+		}
+		return best
+	}
+
+	n := atomic.AddUint32(&db.next, 1)
+	return healthy[(n-1)%uint32(len(healthy))]
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"time"
+)
+
+//RetryPolicy controls how often and how quickly a failed
+//transaction is re-run. The zero value makes a single attempt.
+type RetryPolicy struct {
+	MaxAttempts int              //Total attempts, including the first
+	BaseDelay   time.Duration    //Delay before the first retry; doubles for each one after
+	MaxDelay    time.Duration    //Cap on a single delay (no cap if 0)
+	Retryable   func(error) bool //Decides whether an error is worth retrying; IsRetryable if nil
+}
+
+//DefaultRetryPolicy retries deadlocks and lock wait timeouts up to four
+//times, waiting roughly 50ms, 100ms, 200ms and 400ms between attempts.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   50 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+//IsRetryable reports whether err is a MySQL deadlock (1213) or
+//lock wait timeout (1205), after which the transaction can be re-run.
+func IsRetryable(err error) bool {
+	kind := classify(err)
+	return kind == ErrDeadlock || kind == ErrLockTimeout
+}
+
+//Do calls fn until it succeeds, returns an error the policy does not
+//consider retryable, MaxAttempts is reached, or ctx is done. fn must be
+//safe to run again from the start, e.g. a whole transaction.
+//The error from the last attempt is returned.
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+
+		if attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+//backoff returns the delay before retry number attempt (1-based):
+//BaseDelay doubled per attempt, capped at MaxDelay, with the upper
+//half randomized so competing clients don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+//WithTxRetry is WithTx, re-running the whole transaction according to
+//policy when it fails with a retryable error (see IsRetryable). The failed
+//attempt is rolled back before the next one starts, so fn must not have
+//side effects outside the transaction.
+func (db *DB) WithTxRetry(ctx context.Context, opts *sql.TxOptions, policy RetryPolicy, fn func(tx *Tx) error) error {
+	return policy.Do(ctx, func() error {
+		return db.WithTx(ctx, opts, fn)
+	})
+}
@@ -0,0 +1,364 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//handle is implemented by both *sqlx.DB and *sqlx.Tx, so the
+//helpers below run the same way against the pool or inside a transaction.
+type handle interface {
+	sqlx.ExtContext
+	PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error)
+}
+
+//serverInfo caches server settings read on first use for a DB and its
+//transactions. Only successful reads are cached.
+type serverInfo struct {
+	mu        sync.Mutex
+	version   string //VERSION()
+	maxPacket int    //@@max_allowed_packet
+}
+
+//runner holds the implementation shared by the DB and Tx helper methods
+type runner struct {
+	h      handle
+	log    Logger
+	server *serverInfo
+}
+
+//connHandle is a single pooled connection with the rest of handle
+//borrowed from the pool it came from
+type connHandle struct {
+	*sqlx.Conn
+	db *sqlx.DB
+}
+
+func (c connHandle) DriverName() string {
+	return c.db.DriverName()
+}
+
+func (c connHandle) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	return c.db.BindNamed(query, arg)
+}
+
+//pin returns a runner bound to a single connection, for statements
+//that depend on session state. Inside a transaction r is already
+//pinned and is returned as is. release must be called when done.
+func (r runner) pin(ctx context.Context) (runner, func(), error) {
+	db, ok := r.h.(*sqlx.DB)
+	if !ok {
+		return r, func() {}, nil
+	}
+
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return r, nil, queryError(err, "", nil)
+	}
+
+	pinned := r
+	pinned.h = connHandle{Conn: conn, db: db}
+	return pinned, func() { conn.Close() }, nil
+}
+
+//queryx runs a query, logging it and wrapping any error in a *QueryError
+func (r runner) queryx(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	start := time.Now()
+	rows, err := r.h.QueryxContext(ctx, query, args...)
+	err = queryError(err, query, args)
+	r.logStatement(ctx, query, start, -1, err)
+
+	return rows, err
+}
+
+//execContext runs a statement, logging it and wrapping any error in a *QueryError
+func (r runner) execContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := r.h.ExecContext(ctx, query, args...)
+	return r.execDone(ctx, query, args, start, result, err)
+}
+
+//execDone logs a statement started at start and wraps its error
+func (r runner) execDone(ctx context.Context, query string, args []interface{}, start time.Time, result sql.Result, err error) (sql.Result, error) {
+	err = queryError(err, query, args)
+
+	var affected int64 = -1
+	if err == nil {
+		if n, rowsErr := result.RowsAffected(); rowsErr == nil {
+			affected = n
+		}
+	}
+	r.logStatement(ctx, query, start, affected, err)
+
+	return result, err
+}
+
+//bindNamed turns a query with :name parameters into one with
+//placeholders and the matching args taken from arg
+func (r runner) bindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	bound, args, err := r.h.BindNamed(query, arg)
+	if err != nil {
+		return "", nil, &QueryError{SQL: query, Err: err}
+	}
+
+	return bound, args, nil
+}
+
+//logStatement reports a finished statement. rows < 0 means unknown.
+func (r runner) logStatement(ctx context.Context, query string, start time.Time, rows int64, err error) {
+	args := []interface{}{"query", compactSQL(query), "duration", time.Since(start)}
+	if rows >= 0 {
+		args = append(args, "rows", rows)
+	}
+
+	switch {
+	case err == nil:
+		r.log.Log(ctx, LevelDebug, "statement executed", args...)
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		r.log.Log(ctx, LevelWarn, "statement cancelled", append(args, "error", err)...)
+	default:
+		r.log.Log(ctx, LevelError, "statement failed", append(args, "error", err)...)
+	}
+}
+
+func (r runner) execList(ctx context.Context, sqlList []string) (errors []error) {
+	if len(sqlList) == 0 {
+		return
+	}
+
+	cnt := 0
+
+	sqlMultiStatement := ""
+
+	for _, sql := range sqlList {
+
+		cnt++
+
+		//Append semicolon to each string where missing
+		if !strings.HasSuffix(sql, ";") {
+			sql += ";"
+		}
+
+		sqlMultiStatement += sql
+
+		if cnt == 200 {
+			cnt = 0
+			if _, err := r.execContext(ctx, sqlMultiStatement); err != nil {
+				errors = append(errors, err)
+			}
+
+			sqlMultiStatement = ""
+		}
+	}
+
+	//Execute remaining statements, if any
+	if sqlMultiStatement != "" {
+		if _, err := r.execContext(ctx, sqlMultiStatement); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	return errors
+}
+
+func (r runner) execNamedList(ctx context.Context, namedList []*Named) []error {
+	var errors []error
+
+	for _, s := range namedList {
+		if _, err := r.execNamed(ctx, s.SQL, s.StructVal); err != nil {
+			errors = append(errors, err)
+		}
+	}
+
+	if len(errors) > 0 {
+		return errors
+	}
+
+	return nil
+}
+
+func (r runner) getRows(ctx context.Context, parseRows func(*sqlx.Rows), sql string, sqlArgs ...interface{}) error {
+
+	if r.h == nil {
+		return fmt.Errorf("db connection was nil")
+	}
+
+	if sql == "" {
+		return fmt.Errorf("SQL was blank")
+	}
+
+	rows, err := r.queryx(ctx, sql, sqlArgs...)
+	//Check the error before closing the rows!
+	if err != nil {
+		return err
+	}
+
+	if rows == nil {
+		return fmt.Errorf("no rows returned with SQL: %s", sql)
+	}
+
+	defer rows.Close()
+
+	parseRows(rows)
+
+	//Errors hit while parseRows iterated are only reported here
+	return queryError(rows.Err(), sql, sqlArgs)
+}
+
+func (r runner) getRowsFromNamed(ctx context.Context, parseRows func(*sqlx.Rows), sql string, arg interface{}) (int, error) {
+	query, args, err := r.bindNamed(sql, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	//FOUND_ROWS() only works on the connection that ran the query
+	legacy := strings.Contains(strings.ToUpper(query), "SQL_CALC_FOUND_ROWS")
+	if legacy {
+		pinned, release, err := r.pin(ctx)
+		if err != nil {
+			return 0, err
+		}
+		defer release()
+		r = pinned
+	}
+
+	//getRows closes the rows before returning, freeing a pinned
+	//connection for FOUND_ROWS()
+	if err := r.getRows(ctx, parseRows, query, args...); err != nil {
+		return 0, err
+	}
+
+	if legacy {
+		total, err := r.int64Scalar(ctx, "SELECT FOUND_ROWS()")
+		return int(total), err
+	}
+
+	countSQL, countArgs := countQuery(query, args)
+	total, err := r.int64Scalar(ctx, countSQL, countArgs...)
+	return int(total), err
+}
+
+func (r runner) getRowsInQuery(ctx context.Context, parseRows func(*sqlx.Rows), sql string, args ...interface{}) error {
+	if hasEmptySlice(args) {
+		return nil
+	}
+
+	query, args, err := sqlx.In(sql, args...)
+	if err != nil {
+		return &QueryError{SQL: sql, Err: err}
+	}
+
+	return r.getRows(ctx, parseRows, r.h.Rebind(query), args...)
+}
+
+func (r runner) getRowsInNamedQuery(ctx context.Context, parseRows func(*sqlx.Rows), sql string, arg interface{}) error {
+	query, args, err := r.bindNamed(sql, arg)
+	if err != nil {
+		return err
+	}
+
+	return r.getRowsInQuery(ctx, parseRows, query, args...)
+}
+
+//hasEmptySlice reports whether any arg is an empty list for an IN (?)
+func hasEmptySlice(args []interface{}) bool {
+	for _, a := range args {
+		if values, ok := sliceValues(a); ok && len(values) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r runner) execNamed(ctx context.Context, sql string, structVal interface{}) (sql.Result, error) {
+	query, args, err := r.bindNamed(sql, structVal)
+	if err != nil {
+		r.log.Log(ctx, LevelError, "statement failed", "query", compactSQL(sql), "error", err)
+		return nil, err
+	}
+
+	return r.execContext(ctx, query, args...)
+}
+
+func (r runner) exec(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return r.execContext(ctx, sql, args...)
+}
+
+//execPreparedList runs each statement with its own args. A run of
+//consecutive statements with the same SQL shares one prepared statement.
+//With stopOnError, execution ends at the first failure.
+func (r runner) execPreparedList(ctx context.Context, statements []Prepared, stopOnError bool) []PreparedResult {
+	results := make([]PreparedResult, 0, len(statements))
+
+	var stmt *sqlx.Stmt
+	defer func() {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}()
+
+	for i, p := range statements {
+		if stmt != nil && p.SQL != statements[i-1].SQL {
+			stmt.Close()
+			stmt = nil
+		}
+
+		if stmt == nil && i+1 < len(statements) && statements[i+1].SQL == p.SQL {
+			var err error
+			if stmt, err = r.h.PreparexContext(ctx, p.SQL); err != nil {
+				_, err = r.execDone(ctx, p.SQL, p.Args, time.Now(), nil, err)
+				results = append(results, PreparedResult{Err: err})
+				if stopOnError {
+					return results
+				}
+				continue
+			}
+		}
+
+		var result sql.Result
+		var err error
+		if stmt != nil {
+			start := time.Now()
+			result, err = stmt.ExecContext(ctx, p.Args...)
+			result, err = r.execDone(ctx, p.SQL, p.Args, start, result, err)
+		} else {
+			result, err = r.execContext(ctx, p.SQL, p.Args...)
+		}
+
+		results = append(results, PreparedResult{Result: result, Err: err})
+		if err != nil && stopOnError {
+			return results
+		}
+	}
+
+	return results
+}
+
+func (r runner) int64Scalar(ctx context.Context, sqlStr string, args ...interface{}) (int64, error) {
+	var result int64
+	var err error
+
+	start := time.Now()
+	row := r.h.QueryRowxContext(ctx, sqlStr, args...)
+
+	switch err = row.Scan(&result); err {
+	case sql.ErrNoRows:
+		r.logStatement(ctx, sqlStr, start, 0, nil)
+		return 0, fmt.Errorf("no rows returned")
+	case nil:
+		r.logStatement(ctx, sqlStr, start, 1, nil)
+		return result, nil
+	default:
+		err = queryError(err, sqlStr, args)
+		r.logStatement(ctx, sqlStr, start, -1, err)
+		return 0, err
+	}
+}
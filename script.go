@@ -0,0 +1,327 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+//ScriptOptions tunes ExecScript, RunScript and RunScriptFS
+type ScriptOptions struct {
+	BatchSize       int                  //Statements sent per Exec; 1 when 0. Above 1 requires multiStatements=true in the DSN
+	ContinueOnError bool                 //Run the remaining statements after a failure instead of stopping
+	Transaction     bool                 //DB only: run everything in one transaction, rolled back on any failure
+	Progress        func(ScriptProgress) //Called after each statement (or batch) runs
+}
+
+//ScriptProgress is passed to ScriptOptions.Progress
+type ScriptProgress struct {
+	File     string        //Script file, empty for ExecScript and RunScript
+	Index    int           //Index of the (first) statement in its script, from 0
+	Count    int           //Number of statements sent
+	Total    int           //Number of statements in the script
+	SQL      string        //Text of the statement(s)
+	Duration time.Duration //Time the statement(s) took
+	Err      error         //Nil on success
+}
+
+//StatementError reports a failed statement of a script. When statements
+//are sent in batches, the whole batch is reported, since the server
+//doesn't say which of its statements failed.
+type StatementError struct {
+	File  string //Script file, empty for ExecScript and RunScript
+	Index int    //Index of the (first) statement in its script, from 0
+	Count int    //Number of statements in the failed batch
+	SQL   string //Text of the statement(s)
+	Err   error
+}
+
+func (e *StatementError) Error() string {
+	where := fmt.Sprintf("statement %d", e.Index)
+	if e.Count > 1 {
+		where = fmt.Sprintf("statements %d-%d", e.Index, e.Index+e.Count-1)
+	}
+	if e.File != "" {
+		where = e.File + ": " + where
+	}
+	return fmt.Sprintf("%s: %v", where, e.Err)
+}
+
+//Unwrap returns the statement's error
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+//SplitScript splits a SQL script into its statements, the way the mysql
+//client does. Statements end at the delimiter, ";" unless changed by a
+//DELIMITER line (e.g. "DELIMITER $$" around a stored procedure body);
+//DELIMITER lines themselves are not returned. Delimiters inside quotes,
+//backticks, and comments are ignored. Comment-only fragments are dropped.
+func SplitScript(script string) ([]string, error) {
+	var statements []string
+
+	delimiter := ";"
+	start := 0
+
+	for i := 0; i < len(script); {
+		if isBlankSQL(script[start:i]) && hasKeywordPrefix(script[i:], "DELIMITER") {
+			line := script[i:]
+			if end := strings.IndexByte(line, '\n'); end >= 0 {
+				line = line[:end+1]
+			}
+
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("line %d: DELIMITER without a delimiter", lineNumber(script, i))
+			}
+
+			delimiter = fields[1]
+			i += len(line)
+			start = i
+			continue
+		}
+
+		if end, ok := spanEnd(script, i); end != i {
+			if !ok {
+				return nil, fmt.Errorf("line %d: unterminated quote or comment", lineNumber(script, i))
+			}
+			i = end
+			continue
+		}
+
+		if strings.HasPrefix(script[i:], delimiter) {
+			if statement := strings.TrimSpace(script[start:i]); !isBlankSQL(statement) {
+				statements = append(statements, statement)
+			}
+			i += len(delimiter)
+			start = i
+			continue
+		}
+
+		i++
+	}
+
+	if statement := strings.TrimSpace(script[start:]); !isBlankSQL(statement) {
+		statements = append(statements, statement)
+	}
+
+	return statements, nil
+}
+
+//isBlankSQL reports whether s holds nothing but whitespace and comments.
+//MySQL's executable /*! ... */ comments count as SQL.
+func isBlankSQL(s string) bool {
+	for i := 0; i < len(s); {
+		switch {
+		case isSpace(s[i]):
+			i++
+		case strings.HasPrefix(s[i:], "/*!"):
+			return false
+		default:
+			end, _ := spanEnd(s, i)
+			if end == i || s[i] == '\'' || s[i] == '"' || s[i] == '`' {
+				return false
+			}
+			i = end
+		}
+	}
+
+	return true
+}
+
+//hasKeywordPrefix reports whether s starts with keyword (any case)
+//followed by whitespace
+func hasKeywordPrefix(s, keyword string) bool {
+	return len(s) > len(keyword) && strings.EqualFold(s[:len(keyword)], keyword) && isSpace(s[len(keyword)])
+}
+
+func lineNumber(s string, i int) int {
+	return strings.Count(s[:i], "\n") + 1
+}
+
+//ExecScript splits script with SplitScript and executes its statements in
+//order, unlike ExecList, which needs multiStatements in the DSN and can't
+//tell which statement failed. Each failure is a *StatementError; execution
+//stops at the first one unless opts.ContinueOnError is set.
+func (db *DB) ExecScript(ctx context.Context, script string, opts ScriptOptions) []error {
+	statements, err := SplitScript(script)
+	if err != nil {
+		return []error{err}
+	}
+
+	return db.runScripts(ctx, []scriptFile{{statements: statements}}, opts)
+}
+
+//RunScript is ExecScript for a script read from r, such as an open .sql file
+func (db *DB) RunScript(ctx context.Context, r io.Reader, opts ScriptOptions) []error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return []error{err}
+	}
+
+	return db.ExecScript(ctx, string(b), opts)
+}
+
+//RunScriptFS runs the files in fsys matching glob (see fs.Glob) in name
+//order, e.g. RunScriptFS(ctx, embedded, "schema/*.sql"). Every file is
+//read and split before any runs, so a malformed file runs nothing. With
+//opts.Transaction all files run in the same transaction.
+func (db *DB) RunScriptFS(ctx context.Context, fsys fs.FS, glob string, opts ScriptOptions) []error {
+	files, err := readScripts(fsys, glob)
+	if err != nil {
+		return []error{err}
+	}
+
+	return db.runScripts(ctx, files, opts)
+}
+
+//ExecScript is DB.ExecScript inside the transaction; opts.Transaction is
+//ignored. Note that MySQL commits implicitly before and after most DDL
+//statements.
+func (tx *Tx) ExecScript(ctx context.Context, script string, opts ScriptOptions) []error {
+	statements, err := SplitScript(script)
+	if err != nil {
+		return []error{err}
+	}
+
+	return tx.runner().runScripts(ctx, []scriptFile{{statements: statements}}, opts)
+}
+
+//RunScript is DB.RunScript inside the transaction
+func (tx *Tx) RunScript(ctx context.Context, r io.Reader, opts ScriptOptions) []error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return []error{err}
+	}
+
+	return tx.ExecScript(ctx, string(b), opts)
+}
+
+//RunScriptFS is DB.RunScriptFS inside the transaction
+func (tx *Tx) RunScriptFS(ctx context.Context, fsys fs.FS, glob string, opts ScriptOptions) []error {
+	files, err := readScripts(fsys, glob)
+	if err != nil {
+		return []error{err}
+	}
+
+	return tx.runner().runScripts(ctx, files, opts)
+}
+
+//scriptFile is a split script and the file it came from
+type scriptFile struct {
+	name       string
+	statements []string
+}
+
+//readScripts reads and splits the files in fsys matching glob
+func readScripts(fsys fs.FS, glob string) ([]scriptFile, error) {
+	names, err := fs.Glob(fsys, glob)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no scripts match %q", glob)
+	}
+
+	files := make([]scriptFile, 0, len(names))
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		statements, err := SplitScript(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+
+		files = append(files, scriptFile{name: name, statements: statements})
+	}
+
+	return files, nil
+}
+
+//runScripts runs files on the pool, or in a transaction if opts.Transaction
+func (db *DB) runScripts(ctx context.Context, files []scriptFile, opts ScriptOptions) []error {
+	if !opts.Transaction {
+		return db.runner().runScripts(ctx, files, opts)
+	}
+
+	var errs []error
+	err := db.WithTx(ctx, nil, func(tx *Tx) error {
+		errs = tx.runner().runScripts(ctx, files, opts)
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	})
+
+	if err != nil && len(errs) == 0 {
+		errs = []error{err}
+	}
+
+	return errs
+}
+
+func (r runner) runScripts(ctx context.Context, files []scriptFile, opts ScriptOptions) []error {
+	var errs []error
+
+	for _, f := range files {
+		errs = append(errs, r.execStatements(ctx, f, opts)...)
+		if len(errs) > 0 && !opts.ContinueOnError {
+			break
+		}
+	}
+
+	return errs
+}
+
+//execStatements runs a file's statements one at a time or in batches of
+//opts.BatchSize
+func (r runner) execStatements(ctx context.Context, f scriptFile, opts ScriptOptions) []error {
+	var errs []error
+
+	size := opts.BatchSize
+	if size < 1 {
+		size = 1
+	}
+
+	for lo := 0; lo < len(f.statements); lo += size {
+		hi := lo + size
+		if hi > len(f.statements) {
+			hi = len(f.statements)
+		}
+
+		query := f.statements[lo]
+		if hi-lo > 1 {
+			query = strings.Join(f.statements[lo:hi], ";\n")
+		}
+
+		start := time.Now()
+		_, err := r.execContext(ctx, query)
+
+		if opts.Progress != nil {
+			opts.Progress(ScriptProgress{
+				File:     f.name,
+				Index:    lo,
+				Count:    hi - lo,
+				Total:    len(f.statements),
+				SQL:      query,
+				Duration: time.Since(start),
+				Err:      err,
+			})
+		}
+
+		if err != nil {
+			errs = append(errs, &StatementError{File: f.name, Index: lo, Count: hi - lo, SQL: query, Err: err})
+			if !opts.ContinueOnError {
+				break
+			}
+		}
+	}
+
+	return errs
+}
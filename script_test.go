@@ -0,0 +1,106 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "plain statements",
+			script: "CREATE TABLE a (x INT);\nINSERT INTO a VALUES (1);\n",
+			want:   []string{"CREATE TABLE a (x INT)", "INSERT INTO a VALUES (1)"},
+		},
+		{
+			name:   "last statement without delimiter",
+			script: "SELECT 1; SELECT 2",
+			want:   []string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			name: "DELIMITER around a procedure body",
+			script: "DELIMITER $$\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND$$\n" +
+				"delimiter ;\n" +
+				"CALL p();",
+			want: []string{"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND", "CALL p()"},
+		},
+		{
+			name:   "delimiters in quotes and backticks",
+			script: "INSERT INTO `we;ird` VALUES ('a;b', \"c;d\");SELECT 1;",
+			want:   []string{"INSERT INTO `we;ird` VALUES ('a;b', \"c;d\")", "SELECT 1"},
+		},
+		{
+			name:   "backslash-escaped quotes",
+			script: `INSERT INTO a VALUES ('it\'s;', "say \";\"");SELECT 1;`,
+			want:   []string{`INSERT INTO a VALUES ('it\'s;', "say \";\"")`, "SELECT 1"},
+		},
+		{
+			name:   "doubled quotes",
+			script: "INSERT INTO a VALUES ('it''s;', \"a\"\";\");SELECT 1;",
+			want:   []string{"INSERT INTO a VALUES ('it''s;', \"a\"\";\")", "SELECT 1"},
+		},
+		{
+			name:   "line comments",
+			script: "-- setup; comment\nSELECT 1; # trailing; comment\nSELECT 2;",
+			want:   []string{"-- setup; comment\nSELECT 1", "# trailing; comment\nSELECT 2"},
+		},
+		{
+			name:   "double dash without a space is not a comment",
+			script: "SELECT 5--1;SELECT 2;",
+			want:   []string{"SELECT 5--1", "SELECT 2"},
+		},
+		{
+			name:   "block comments",
+			script: "/* header; */ SELECT /* inline; */ 1;",
+			want:   []string{"/* header; */ SELECT /* inline; */ 1"},
+		},
+		{
+			name:   "executable comments are statements",
+			script: "/*!40101 SET NAMES utf8mb4 */;\n/* just a comment */;",
+			want:   []string{"/*!40101 SET NAMES utf8mb4 */"},
+		},
+		{
+			name:   "empty and comment-only",
+			script: " ;\n-- nothing\n;;",
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := SplitScript(tt.script)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+			continue
+		}
+
+		if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") || len(got) != len(tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitScriptErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"unterminated single quote", "SELECT 1;\nSELECT 'abc;", "line 2: unterminated"},
+		{"unterminated double quote", `SELECT "abc`, "line 1: unterminated"},
+		{"unterminated backtick", "SELECT `abc", "line 1: unterminated"},
+		{"unterminated block comment", "SELECT 1;\n\n/* never closed", "line 3: unterminated"},
+		{"DELIMITER without a delimiter", "DELIMITER \nSELECT 1", "line 1: DELIMITER without"},
+	}
+
+	for _, tt := range tests {
+		_, err := SplitScript(tt.script)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
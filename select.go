@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//Querier is implemented by *DB and *Tx, so the generic helpers
+//below work the same on the pool and inside a transaction. On a DB
+//with replicas they read from a replica (see SetReplicas).
+type Querier interface {
+	reader(ctx context.Context) runner
+}
+
+//Select runs query and scans every row into a T. T is either a struct,
+//filled by column name using db tags, or a single-column type such as
+//int64, string, NullString, or time.Time. No rows is an empty slice.
+func Select[T any](ctx context.Context, q Querier, query string, args ...interface{}) ([]T, error) {
+	return selectRows[T](ctx, q.reader(ctx), query, args...)
+}
+
+//selectRows is Select on a runner already picked from a Querier
+func selectRows[T any](ctx context.Context, r runner, query string, args ...interface{}) ([]T, error) {
+	rows, err := r.queryx(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []T{}
+	for rows.Next() {
+		item, err := scanRow[T](rows)
+		if err != nil {
+			return nil, queryError(err, query, args)
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, queryError(err, query, args)
+	}
+
+	return items, nil
+}
+
+//Get is Select for a single row. It returns ErrNotFound if the query
+//matches nothing; further rows are ignored.
+func Get[T any](ctx context.Context, q Querier, query string, args ...interface{}) (T, error) {
+	var item T
+	r := q.reader(ctx)
+
+	rows, err := r.queryx(ctx, query, args...)
+	if err != nil {
+		return item, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return item, queryError(err, query, args)
+		}
+		return item, ErrNotFound
+	}
+
+	if item, err = scanRow[T](rows); err != nil {
+		return item, queryError(err, query, args)
+	}
+
+	return item, nil
+}
+
+//Scalar returns the first column of the first row, e.g.
+//Scalar[int64](ctx, db, "SELECT COUNT(*) FROM t"). It returns
+//ErrNotFound if the query matches nothing.
+func Scalar[T any](ctx context.Context, q Querier, query string, args ...interface{}) (T, error) {
+	var value T
+	r := q.reader(ctx)
+
+	rows, err := r.queryx(ctx, query, args...)
+	if err != nil {
+		return value, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return value, queryError(err, query, args)
+		}
+		return value, ErrNotFound
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return value, queryError(err, query, args)
+	}
+
+	//Discard any columns after the first
+	dest := make([]interface{}, len(columns))
+	dest[0] = &value
+	for i := 1; i < len(dest); i++ {
+		dest[i] = new(sql.RawBytes)
+	}
+
+	if err := rows.Scan(dest...); err != nil {
+		return value, queryError(err, query, args)
+	}
+
+	return value, nil
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+//scanRow scans the current row into a T. Struct types (and pointers
+//to them) are filled by column name unless they are scanners themselves.
+func scanRow[T any](rows *sqlx.Rows) (T, error) {
+	var item T
+
+	t := reflect.TypeOf(item)
+	if t != nil && t.Kind() == reflect.Ptr && isRowStruct(t.Elem()) {
+		v := reflect.New(t.Elem())
+		err := rows.StructScan(v.Interface())
+		return v.Interface().(T), err
+	}
+
+	if t != nil && isRowStruct(t) {
+		err := rows.StructScan(&item)
+		return item, err
+	}
+
+	err := rows.Scan(&item)
+	return item, err
+}
+
+//isRowStruct reports whether t is scanned field by field rather than as one value
+func isRowStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{}) && !reflect.PtrTo(t).Implements(scannerType)
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//DefaultChunkSize is the number of IDs per query SelectIn uses by default
+const DefaultChunkSize = 1000
+
+//ChunkOptions tunes SelectIn
+type ChunkOptions struct {
+	Size        int //IDs per query; DefaultChunkSize when 0
+	Concurrency int //Most chunks queried at once; 1 (one after another) when 0
+}
+
+//ChunkErrors is returned when one or more chunks fail. It holds
+//every failed chunk's error, in chunk order.
+type ChunkErrors []*ChunkError
+
+func (e ChunkErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d chunks failed, first: %v", len(e), e[0])
+}
+
+//Unwrap returns the first chunk's error, so errors.Is and errors.As
+//see the first failure
+func (e ChunkErrors) Unwrap() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e[0]
+}
+
+//SelectIn is Select for lookups by a list of IDs too long for one
+//statement. query must have its IN (?) as the last placeholder, e.g.
+//"SELECT * FROM t WHERE kind = ? AND id IN (?)", with args filling the
+//placeholders before it. ids is split into chunks of opts.Size, each
+//queried separately, up to opts.Concurrency at a time (always one at a
+//time inside a transaction). Results are returned chunk after chunk in
+//the order of ids, so they are the same on every run; an ORDER BY only
+//applies within a chunk. The first chunk to fail cancels the ones still
+//running or waiting; no results are returned and the error is a
+//ChunkErrors of the chunks that failed on their own. If ctx ends first,
+//the chunks it stopped are reported with ctx's error.
+func SelectIn[T any, K any](ctx context.Context, q Querier, query string, ids []K, opts ChunkOptions, args ...interface{}) ([]T, error) {
+	size := opts.Size
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+
+	workers := opts.Concurrency
+	if _, inTx := q.(*Tx); workers < 1 || inTx {
+		workers = 1
+	}
+
+	chunks := (len(ids) + size - 1) / size
+	results := make([][]T, chunks)
+	errs := make([]*ChunkError, chunks)
+	ran := make([]bool, chunks)
+
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bounds := func(c int) (int, int) {
+		if hi := (c + 1) * size; hi < len(ids) {
+			return c * size, hi
+		}
+		return c * size, len(ids)
+	}
+
+	run := func(c int) {
+		lo, hi := bounds(c)
+
+		chunkArgs := append(append([]interface{}{}, args...), ids[lo:hi])
+		expanded, expandedArgs, err := sqlx.In(query, chunkArgs...)
+		if err == nil {
+			//One reader per chunk, so each chunk is a single replica pick
+			r := q.reader(chunkCtx)
+			results[c], err = selectRows[T](chunkCtx, r, r.h.Rebind(expanded), expandedArgs...)
+		}
+
+		//A chunk cancelled because another failed isn't a failure of its own
+		if err != nil && (ctx.Err() != nil || chunkCtx.Err() == nil) {
+			errs[c] = &ChunkError{Chunk: c, Offset: lo, Rows: hi - lo, Err: err}
+			cancel()
+		}
+	}
+
+	if workers == 1 {
+		for c := 0; c < chunks && chunkCtx.Err() == nil; c++ {
+			ran[c] = true
+			run(c)
+		}
+	} else {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, workers)
+
+		for c := 0; c < chunks; c++ {
+			sem <- struct{}{}
+			if chunkCtx.Err() != nil {
+				break
+			}
+
+			ran[c] = true
+			wg.Add(1)
+			go func(c int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				run(c)
+			}(c)
+		}
+
+		wg.Wait()
+	}
+
+	var failed ChunkErrors
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, failed
+	}
+
+	//Nothing failed, so any chunk that never ran was stopped by ctx
+	for c := range ran {
+		if !ran[c] {
+			err := ctx.Err()
+			if err == nil {
+				err = context.Canceled
+			}
+
+			lo, hi := bounds(c)
+			failed = append(failed, &ChunkError{Chunk: c, Offset: lo, Rows: hi - lo, Err: err})
+		}
+	}
+	if len(failed) > 0 {
+		return nil, failed
+	}
+
+	items := []T{}
+	for _, r := range results {
+		items = append(items, r...)
+	}
+
+	return items, nil
+}
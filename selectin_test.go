@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//echoConnector is a driver whose queries return their args as rows of
+//one "id" column. done, when set, runs as each query's rows are closed.
+type echoConnector struct {
+	done func()
+}
+
+func (c echoConnector) Connect(context.Context) (driver.Conn, error) {
+	return echoConn{c.done}, nil
+}
+
+func (echoConnector) Driver() driver.Driver {
+	return nil
+}
+
+type echoConn struct {
+	done func()
+}
+
+func (c echoConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	rows := &echoRows{done: c.done}
+	for _, a := range args {
+		rows.values = append(rows.values, a.Value)
+	}
+	return rows, nil
+}
+
+func (echoConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("stub: no prepared statements")
+}
+
+func (echoConn) Close() error {
+	return nil
+}
+
+func (echoConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("stub: no transactions")
+}
+
+type echoRows struct {
+	values []driver.Value
+	done   func()
+}
+
+func (*echoRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *echoRows) Close() error {
+	if r.done != nil {
+		r.done()
+	}
+	return nil
+}
+
+func (r *echoRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	dest[0], r.values = r.values[0], r.values[1:]
+	return nil
+}
+
+func echoDB(t *testing.T, done func()) *DB {
+	t.Helper()
+
+	db := New(sqlx.NewDb(sql.OpenDB(echoConnector{done}), "mysql"))
+	db.SetLogger(nil)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestSelectIn(t *testing.T) {
+	db := echoDB(t, nil)
+
+	for _, workers := range []int{1, 3} {
+		got, err := SelectIn[int64](context.Background(), db, "SELECT id FROM t WHERE id IN (?)", []int64{1, 2, 3, 4, 5, 6, 7}, ChunkOptions{Size: 2, Concurrency: workers})
+		if err != nil {
+			t.Fatalf("%d workers: %v", workers, err)
+		}
+		if len(got) != 7 || got[0] != 1 || got[6] != 7 {
+			t.Errorf("%d workers: got %v, want 1 through 7 in order", workers, got)
+		}
+	}
+}
+
+func TestSelectInCancelled(t *testing.T) {
+	ids := []int64{1, 2, 3, 4}
+
+	for _, workers := range []int{1, 2} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		got, err := SelectIn[int64](ctx, echoDB(t, nil), "SELECT id FROM t WHERE id IN (?)", ids, ChunkOptions{Size: 1, Concurrency: workers})
+		if got != nil || !errors.Is(err, context.Canceled) {
+			t.Errorf("%d workers, cancelled before: got %v, %v; want no items and context.Canceled", workers, got, err)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		db := echoDB(t, cancel)
+
+		got, err = SelectIn[int64](ctx, db, "SELECT id FROM t WHERE id IN (?)", ids, ChunkOptions{Size: 1, Concurrency: workers})
+		if got != nil || !errors.Is(err, context.Canceled) {
+			t.Errorf("%d workers, cancelled after a chunk: got %v, %v; want no items and context.Canceled", workers, got, err)
+		}
+		cancel()
+	}
+}
+
+func TestSelectInSpreadsChunksOverReplicas(t *testing.T) {
+	db := echoDB(t, nil)
+
+	counts := make([]int, 2)
+	var pools []*sqlx.DB
+	for i := range counts {
+		i := i
+		pools = append(pools, sqlx.NewDb(sql.OpenDB(echoConnector{func() { counts[i]++ }}), "mysql"))
+	}
+	db.SetReplicas(RoundRobin, pools...)
+
+	if _, err := SelectIn[int64](context.Background(), db, "SELECT id FROM t WHERE id IN (?)", []int64{1, 2, 3, 4}, ChunkOptions{Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if counts[0] != 2 || counts[1] != 2 {
+		t.Errorf("chunks per replica = %v, want 2 each", counts)
+	}
+}
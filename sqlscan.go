@@ -0,0 +1,237 @@
+package database
+
+import (
+	"strings"
+)
+
+//skipSpan returns the index just past the quoted string, quoted
+//identifier, or comment starting at s[i], or i if none starts there.
+//Unterminated spans run to the end of s.
+func skipSpan(s string, i int) int {
+	end, _ := spanEnd(s, i)
+	return end
+}
+
+//spanEnd is skipSpan that also reports whether the span was terminated
+func spanEnd(s string, i int) (int, bool) {
+	switch c := s[i]; {
+	case c == '\'' || c == '"' || c == '`':
+		for j := i + 1; j < len(s); j++ {
+			switch {
+			case s[j] == '\\' && c != '`':
+				j++
+			case s[j] == c:
+				//A doubled quote is an escaped quote
+				if j+1 < len(s) && s[j+1] == c {
+					j++
+					continue
+				}
+				return j + 1, true
+			}
+		}
+		return len(s), false
+
+	case c == '#' || (c == '-' && strings.HasPrefix(s[i:], "--") && (i+2 == len(s) || isSpace(s[i+2]))):
+		if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+			return i + end + 1, true
+		}
+		return len(s), true
+
+	case c == '/' && strings.HasPrefix(s[i:], "/*"):
+		if end := strings.Index(s[i+2:], "*/"); end >= 0 {
+			return i + 2 + end + 2, true
+		}
+		return len(s), false
+	}
+
+	return i, true
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+//lastTopLevelKeyword returns the index of the last occurrence of keyword
+//(case-insensitive, as a whole word) in query that is not inside
+//parentheses, quotes, or comments; -1 if there is none.
+func lastTopLevelKeyword(query, keyword string) int {
+	found := topLevelKeywords(query, keyword)
+	if len(found) == 0 {
+		return -1
+	}
+	return found[len(found)-1]
+}
+
+//topLevelKeywords returns the indexes of every occurrence of keyword
+//(case-insensitive, as a whole word) in query that is not inside
+//parentheses, quotes, or comments
+func topLevelKeywords(query, keyword string) []int {
+	var found []int
+	depth := 0
+
+	for i := 0; i < len(query); {
+		if next := skipSpan(query, i); next != i {
+			i = next
+			continue
+		}
+
+		switch c := query[i]; {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (i == 0 || !isWordChar(query[i-1])) &&
+			len(query)-i >= len(keyword) && strings.EqualFold(query[i:i+len(keyword)], keyword) &&
+			(i+len(keyword) == len(query) || !isWordChar(query[i+len(keyword)])):
+			found = append(found, i)
+			i += len(keyword)
+			continue
+		}
+		i++
+	}
+
+	return found
+}
+
+//countPlaceholders counts the ? placeholders in s outside quotes and comments
+func countPlaceholders(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if next := skipSpan(s, i); next != i {
+			i = next
+			continue
+		}
+		if s[i] == '?' {
+			n++
+		}
+		i++
+	}
+
+	return n
+}
+
+//stripLimit removes a trailing semicolon and the top-level LIMIT clause
+//from query, along with the args for any placeholders in that clause
+func stripLimit(query string, args []interface{}) (string, []interface{}) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+
+	if i := lastTopLevelKeyword(query, "LIMIT"); i >= 0 {
+		tail := countPlaceholders(query[i:])
+		if tail <= len(args) {
+			args = args[:len(args)-tail]
+		}
+		query = strings.TrimSpace(query[:i])
+	}
+
+	return query, args
+}
+
+//stripOrderBy removes the top-level ORDER BY clause from a query
+//without a LIMIT, along with the args for any placeholders in it
+func stripOrderBy(query string, args []interface{}) (string, []interface{}) {
+	i := lastTopLevelKeyword(query, "ORDER")
+	if i < 0 {
+		return query, args
+	}
+
+	rest := strings.TrimLeft(query[i+len("ORDER"):], " \t\n\r\f\v")
+	if len(rest) < 2 || !strings.EqualFold(rest[:2], "BY") || (len(rest) > 2 && isWordChar(rest[2])) {
+		return query, args
+	}
+
+	if tail := countPlaceholders(query[i:]); tail <= len(args) {
+		args = args[:len(args)-tail]
+	}
+
+	return strings.TrimSpace(query[:i]), args
+}
+
+//countQuery turns a SELECT into one that counts the rows it would return
+//without its top-level LIMIT; args are trimmed to match. The top-level
+//ORDER BY goes too: it can't change the count, and it may name aliases
+//or positions of a select list countSelectList replaces.
+func countQuery(query string, args []interface{}) (string, []interface{}) {
+	query, args = stripLimit(query, args)
+	query, args = stripOrderBy(query, args)
+	query, args = countSelectList(query, args)
+	return "SELECT COUNT(*) FROM (" + query + ") AS counted", args
+}
+
+//aggregates are the functions that fold rows together
+var aggregates = map[string]bool{
+	"AVG": true, "BIT_AND": true, "BIT_OR": true, "BIT_XOR": true, "COUNT": true,
+	"GROUP_CONCAT": true, "JSON_ARRAYAGG": true, "JSON_OBJECTAGG": true, "MAX": true,
+	"MIN": true, "STD": true, "STDDEV": true, "STDDEV_POP": true, "STDDEV_SAMP": true,
+	"SUM": true, "VAR_POP": true, "VAR_SAMP": true, "VARIANCE": true,
+}
+
+//countSelectList replaces the select list of query with 1, so columns of
+//the same name from joined tables (SELECT a.*, b.*) don't clash in the
+//derived table countQuery wraps it in. Args for placeholders in the list
+//are dropped. Queries whose row count depends on the select list (DISTINCT,
+//aggregates, GROUP BY, HAVING, UNION) or that aren't a plain SELECT are
+//returned unchanged.
+func countSelectList(query string, args []interface{}) (string, []interface{}) {
+	selects := topLevelKeywords(query, "SELECT")
+	froms := topLevelKeywords(query, "FROM")
+	if len(selects) != 1 || len(froms) == 0 || !isBlankSQL(query[:selects[0]]) {
+		return query, args
+	}
+
+	for _, keyword := range []string{"DISTINCT", "DISTINCTROW", "GROUP", "HAVING", "UNION"} {
+		if len(topLevelKeywords(query, keyword)) > 0 {
+			return query, args
+		}
+	}
+
+	start, end := selects[0]+len("SELECT"), froms[0]
+	list := query[start:end]
+	if hasAggregate(list) {
+		return query, args
+	}
+
+	if n := countPlaceholders(list); n > 0 {
+		before := countPlaceholders(query[:start])
+		if before+n > len(args) {
+			return query, args
+		}
+		args = append(append([]interface{}{}, args[:before]...), args[before+n:]...)
+	}
+
+	return query[:start] + " 1 " + query[end:], args
+}
+
+//hasAggregate reports whether s calls an aggregate function, at any depth
+func hasAggregate(s string) bool {
+	for i := 0; i < len(s); {
+		if next := skipSpan(s, i); next != i {
+			i = next
+			continue
+		}
+
+		if !isWordChar(s[i]) {
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(s) && isWordChar(s[j]) {
+			j++
+		}
+		word := s[i:j]
+
+		for j < len(s) && isSpace(s[j]) {
+			j++
+		}
+		if j < len(s) && s[j] == '(' && aggregates[strings.ToUpper(word)] {
+			return true
+		}
+		i = j
+	}
+
+	return false
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestStripLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  string
+		wargs string
+	}{
+		{"no LIMIT", "SELECT * FROM t", nil, "SELECT * FROM t", "[]"},
+		{"trailing semicolon", "SELECT * FROM t LIMIT 10;", nil, "SELECT * FROM t", "[]"},
+		{"placeholders", "SELECT * FROM t WHERE a = ? LIMIT ? OFFSET ?", []interface{}{1, 10, 20}, "SELECT * FROM t WHERE a = ?", "[1]"},
+		{"ORDER BY is kept", "SELECT * FROM t ORDER BY id DESC LIMIT ?", []interface{}{5}, "SELECT * FROM t ORDER BY id DESC", "[]"},
+		{"LIMIT in a subquery", "SELECT * FROM (SELECT id FROM t LIMIT 5) AS x", nil, "SELECT * FROM (SELECT id FROM t LIMIT 5) AS x", "[]"},
+		{"LIMIT in a string", "SELECT * FROM t WHERE note = 'LIMIT 1'", nil, "SELECT * FROM t WHERE note = 'LIMIT 1'", "[]"},
+	}
+
+	for _, tt := range tests {
+		got, args := stripLimit(tt.query, tt.args)
+		if got != tt.want {
+			t.Errorf("%s: query = %q, want %q", tt.name, got, tt.want)
+		}
+		if fmt.Sprint(args) != tt.wargs {
+			t.Errorf("%s: args = %v, want %s", tt.name, args, tt.wargs)
+		}
+	}
+}
+
+func TestCountQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  string
+		wargs string
+	}{
+		{
+			"ORDER BY an alias",
+			"SELECT id, name AS n FROM users ORDER BY n LIMIT 10", nil,
+			"SELECT 1 FROM users", "[]",
+		},
+		{
+			"ORDER BY a position, LIMIT with placeholders",
+			"SELECT id, name FROM users WHERE age > ? ORDER BY 2 DESC LIMIT ?, ?", []interface{}{18, 0, 10},
+			"SELECT 1 FROM users WHERE age > ?", "[18]",
+		},
+		{
+			"placeholders in ORDER BY",
+			"SELECT * FROM t WHERE kind = ? ORDER BY FIELD(id, ?, ?)", []interface{}{"a", 3, 1},
+			"SELECT 1 FROM t WHERE kind = ?", "[a]",
+		},
+		{
+			"placeholders in the select list",
+			"SELECT id, ? AS tag FROM t WHERE a = ? LIMIT ?", []interface{}{"x", 1, 5},
+			"SELECT 1 FROM t WHERE a = ?", "[1]",
+		},
+		{
+			"joined tables",
+			"SELECT a.*, b.* FROM a JOIN b ON b.a_id = a.id", nil,
+			"SELECT 1 FROM a JOIN b ON b.a_id = a.id", "[]",
+		},
+		{
+			"DISTINCT passes through",
+			"SELECT DISTINCT kind FROM t ORDER BY kind", nil,
+			"SELECT DISTINCT kind FROM t", "[]",
+		},
+		{
+			"GROUP BY passes through",
+			"SELECT kind, ? AS x FROM t GROUP BY kind ORDER BY 2 LIMIT 5", []interface{}{"x"},
+			"SELECT kind, ? AS x FROM t GROUP BY kind", "[x]",
+		},
+		{
+			"aggregates pass through",
+			"SELECT MAX(id) FROM t", nil,
+			"SELECT MAX(id) FROM t", "[]",
+		},
+		{
+			"ORDER BY in a subquery and window",
+			"SELECT id, ROW_NUMBER() OVER (ORDER BY id) FROM (SELECT id FROM t ORDER BY id LIMIT 5) AS x", nil,
+			"SELECT 1 FROM (SELECT id FROM t ORDER BY id LIMIT 5) AS x", "[]",
+		},
+		{
+			"ORDER BY in a string",
+			"SELECT id FROM t WHERE note = 'ORDER BY x' ORDER BY id", nil,
+			"SELECT 1 FROM t WHERE note = 'ORDER BY x'", "[]",
+		},
+	}
+
+	for _, tt := range tests {
+		got, args := countQuery(tt.query, tt.args)
+		if want := "SELECT COUNT(*) FROM (" + tt.want + ") AS counted"; got != want {
+			t.Errorf("%s: query = %q, want %q", tt.name, got, want)
+		}
+		if fmt.Sprint(args) != tt.wargs {
+			t.Errorf("%s: args = %v, want %s", tt.name, args, tt.wargs)
+		}
+	}
+}
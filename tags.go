@@ -0,0 +1,117 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//dbField is a struct field mapped to a table column through its db tag
+type dbField struct {
+	Name   string //Go field name
+	Column string //db tag value
+	Index  []int  //Index sequence for reflect.Value.FieldByIndex
+}
+
+//dbFields returns the fields of struct type t that carry a db tag.
+//Unexported fields and fields tagged `db:"-"` are skipped. Embedded structs
+//without a db tag of their own are flattened into the result, as sqlx does.
+func dbFields(t reflect.Type) []dbField {
+	var fields []dbField
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		key := strings.Split(field.Tag.Get("db"), ",")[0]
+		if key == "-" {
+			continue
+		}
+
+		if field.Anonymous && key == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+
+			if embedded.Kind() == reflect.Struct {
+				for _, f := range dbFields(embedded) {
+					f.Index = append([]int{i}, f.Index...)
+					fields = append(fields, f)
+				}
+			}
+			continue
+		}
+
+		if field.PkgPath != "" || key == "" {
+			continue
+		}
+
+		fields = append(fields, dbField{Name: field.Name, Column: key, Index: []int{i}})
+	}
+
+	return fields
+}
+
+//fieldValue is v.FieldByIndex(index) for a field found by dbFields, but
+//where the path goes through a nil embedded pointer it returns the
+//field's zero value instead of panicking, as sqlx does when binding args
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Zero(v.Type().Elem().FieldByIndex(index[i:]).Type)
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+//structType returns the struct type behind v, which may be a struct,
+//a pointer to one, a slice of either, or a reflect.Type of any of those.
+func structType(v interface{}) (reflect.Type, error) {
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected struct, got %T", v)
+	}
+
+	return t, nil
+}
+
+//Columns returns the column names (db tags) of the struct behind
+//structVal, in field order. structVal may be a struct, a pointer to
+//one, or a slice of either.
+func Columns(structVal interface{}) ([]string, error) {
+	t, err := structType(structVal)
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	for _, f := range dbFields(t) {
+		columns = append(columns, f.Column)
+	}
+
+	return columns, nil
+}
+
+//quoteIdentifier wraps a column or table name in backticks. A dotted
+//name (table.column) has each part quoted.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + strings.Replace(p, "`", "``", -1) + "`"
+	}
+
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//Tx is a transaction handed to the function passed to WithTx.
+//It has the same helper methods as DB; the variants without a
+//context use the context WithTx was called with.
+type Tx struct {
+	*sqlx.Tx
+	ctx    context.Context
+	logger Logger
+	server *serverInfo
+}
+
+//WithTx runs fn inside a transaction. The transaction is committed
+//if fn returns nil and rolled back if fn returns an error or panics;
+//a panic is re-raised after the rollback. fn must not call Commit
+//or Rollback itself. opts may be nil.
+func (db *DB) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) error {
+	sqlxTx, err := db.BeginTxx(ctx, opts)
+	if err != nil {
+		return queryError(err, "BEGIN", nil)
+	}
+
+	tx := &Tx{Tx: sqlxTx, ctx: ctx, logger: db.Logger(), server: &db.server}
+
+	defer func() {
+		if p := recover(); p != nil {
+			sqlxTx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := sqlxTx.Rollback(); rbErr != nil && rbErr != sql.ErrTxDone {
+			tx.logger.Log(ctx, LevelError, "rollback failed", "error", rbErr)
+		}
+		return err
+	}
+
+	return queryError(sqlxTx.Commit(), "COMMIT", nil)
+}
+
+//runner returns the helper implementation bound to the transaction
+func (tx *Tx) runner() runner {
+	return runner{h: tx.Tx, log: tx.logger, server: tx.server}
+}
+
+//reader is runner: reads in a transaction stay in it
+func (tx *Tx) reader(ctx context.Context) runner {
+	return tx.runner()
+}
+
+//ExecList executes the statements in batches of 200 (see DB.ExecList).
+func (tx *Tx) ExecList(sqlList []string) []error {
+	return tx.ExecListContext(tx.ctx, sqlList)
+}
+
+//ExecListContext is ExecList with a context.
+func (tx *Tx) ExecListContext(ctx context.Context, sqlList []string) []error {
+	return tx.runner().execList(ctx, sqlList)
+}
+
+//ExecNamedList ...
+func (tx *Tx) ExecNamedList(namedList []*Named) []error {
+	return tx.ExecNamedListContext(tx.ctx, namedList)
+}
+
+//ExecNamedListContext is ExecNamedList with a context.
+func (tx *Tx) ExecNamedListContext(ctx context.Context, namedList []*Named) []error {
+	return tx.runner().execNamedList(ctx, namedList)
+}
+
+//GetRows ...
+func (tx *Tx) GetRows(parseRows func(*sqlx.Rows), sql string, sqlArgs ...interface{}) error {
+	return tx.GetRowsContext(tx.ctx, parseRows, sql, sqlArgs...)
+}
+
+//GetRowsContext is GetRows with a context.
+func (tx *Tx) GetRowsContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, sqlArgs ...interface{}) error {
+	return tx.runner().getRows(ctx, parseRows, sql, sqlArgs...)
+}
+
+//GetRowsFromNamed runs a named query and returns the total rows it
+//matches ignoring its LIMIT (see DB.GetRowsFromNamed).
+func (tx *Tx) GetRowsFromNamed(parseRows func(*sqlx.Rows), sql string, arg interface{}) (total int, err error) {
+	return tx.GetRowsFromNamedContext(tx.ctx, parseRows, sql, arg)
+}
+
+//GetRowsFromNamedContext is GetRowsFromNamed with a context.
+func (tx *Tx) GetRowsFromNamedContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, arg interface{}) (total int, err error) {
+	return tx.runner().getRowsFromNamed(ctx, parseRows, sql, arg)
+}
+
+//GetRowsInQuery runs a query with IN (?) lists (see DB.GetRowsInQuery).
+func (tx *Tx) GetRowsInQuery(parseRows func(*sqlx.Rows), sql string, args ...interface{}) error {
+	return tx.GetRowsInQueryContext(tx.ctx, parseRows, sql, args...)
+}
+
+//GetRowsInQueryContext is GetRowsInQuery with a context.
+func (tx *Tx) GetRowsInQueryContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, args ...interface{}) error {
+	return tx.runner().getRowsInQuery(ctx, parseRows, sql, args...)
+}
+
+//GetRowsInNamedQuery runs a named query with IN (:list) parameters (see DB.GetRowsInNamedQuery).
+func (tx *Tx) GetRowsInNamedQuery(parseRows func(*sqlx.Rows), sql string, arg interface{}) error {
+	return tx.GetRowsInNamedQueryContext(tx.ctx, parseRows, sql, arg)
+}
+
+//GetRowsInNamedQueryContext is GetRowsInNamedQuery with a context.
+func (tx *Tx) GetRowsInNamedQueryContext(ctx context.Context, parseRows func(*sqlx.Rows), sql string, arg interface{}) error {
+	return tx.runner().getRowsInNamedQuery(ctx, parseRows, sql, arg)
+}
+
+//ExecNamed executes the query provided using the struct for values
+func (tx *Tx) ExecNamed(sql string, structVal interface{}) (sql.Result, error) {
+	return tx.ExecNamedContext(tx.ctx, sql, structVal)
+}
+
+//ExecNamedContext is ExecNamed with a context.
+func (tx *Tx) ExecNamedContext(ctx context.Context, sql string, structVal interface{}) (sql.Result, error) {
+	return tx.runner().execNamed(ctx, sql, structVal)
+}
+
+//ExecSingle processes a single sql statement
+func (tx *Tx) ExecSingle(sql string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecSingleContext(tx.ctx, sql, args...)
+}
+
+//ExecSingleContext is ExecSingle with a context.
+func (tx *Tx) ExecSingleContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return tx.runner().exec(ctx, sql, args...)
+}
+
+//ExecPrepared ...
+func (tx *Tx) ExecPrepared(sql string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecPreparedContext(tx.ctx, sql, args...)
+}
+
+//ExecPreparedContext is ExecPrepared with a context.
+func (tx *Tx) ExecPreparedContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return tx.runner().exec(ctx, sql, args...)
+}
+
+//ExecPreparedList executes each statement with its own args (see DB.ExecPreparedList).
+func (tx *Tx) ExecPreparedList(statements []Prepared) []PreparedResult {
+	return tx.ExecPreparedListContext(tx.ctx, statements)
+}
+
+//ExecPreparedListContext is ExecPreparedList with a context.
+func (tx *Tx) ExecPreparedListContext(ctx context.Context, statements []Prepared) []PreparedResult {
+	return tx.runner().execPreparedList(ctx, statements, false)
+}
+
+//Int64Scalar returns an int64 from the first field of the first result row
+//(see DB.Int64Scalar).
+func (tx *Tx) Int64Scalar(sqlStr string, args ...interface{}) (int64, error) {
+	return tx.Int64ScalarContext(tx.ctx, sqlStr, args...)
+}
+
+//Int64ScalarContext is Int64Scalar with a context.
+func (tx *Tx) Int64ScalarContext(ctx context.Context, sqlStr string, args ...interface{}) (int64, error) {
+	return tx.runner().int64Scalar(ctx, sqlStr, args...)
+}
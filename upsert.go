@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//UpsertResult describes the outcome of Upsert. Inserted and Updated are
+//only set for single-row upserts; for slices use RowsAffected, which
+//MySQL counts as 1 per inserted row and 2 per updated row.
+type UpsertResult struct {
+	RowsAffected int64
+	Inserted     bool //The row was new
+	Updated      bool //An existing row was changed
+}
+
+//Upsert inserts structVal into table, or updates the existing row when the
+//insert hits a primary or unique key, using INSERT ... ON DUPLICATE KEY UPDATE.
+//structVal is a struct, a pointer to one, or a slice (upserted in chunks like
+//BulkInsert). Columns come from db tags. updateColumns are the columns
+//overwritten on a duplicate; when empty, every column except conflictColumns
+//is. MySQL picks the conflicting key itself, so conflictColumns only decide
+//what is left alone. On MySQL 8.0.19+ new values are referenced through a
+//row alias, on older servers and MariaDB through VALUES().
+//If neither Inserted nor Updated is set, the existing row already had
+//these values (or the DSN sets clientFoundRows, which hides the difference).
+func (db *DB) Upsert(ctx context.Context, table string, structVal interface{}, conflictColumns, updateColumns []string) (UpsertResult, error) {
+	return db.runner().upsert(ctx, table, structVal, conflictColumns, updateColumns)
+}
+
+//Upsert is DB.Upsert inside the transaction
+func (tx *Tx) Upsert(ctx context.Context, table string, structVal interface{}, conflictColumns, updateColumns []string) (UpsertResult, error) {
+	return tx.runner().upsert(ctx, table, structVal, conflictColumns, updateColumns)
+}
+
+func (r runner) upsert(ctx context.Context, table string, structVal interface{}, conflictColumns, updateColumns []string) (UpsertResult, error) {
+	var result UpsertResult
+
+	values := reflect.ValueOf(structVal)
+	for values.Kind() == reflect.Ptr {
+		values = values.Elem()
+	}
+
+	if !values.IsValid() {
+		return result, fmt.Errorf("expected struct or slice of structs, got %T", structVal)
+	}
+
+	single := values.Kind() == reflect.Struct
+	if single {
+		rows := reflect.MakeSlice(reflect.SliceOf(values.Type()), 1, 1)
+		rows.Index(0).Set(values)
+		values = rows
+	}
+
+	values, fields, err := bulkRows(values.Interface(), nil)
+	if err != nil || values.Len() == 0 {
+		return result, err
+	}
+
+	if _, err := selectFields(fields, conflictColumns); err != nil {
+		return result, err
+	}
+
+	var updates []dbField
+	if len(updateColumns) > 0 {
+		if updates, err = selectFields(fields, updateColumns); err != nil {
+			return result, err
+		}
+	} else {
+		skip := map[string]bool{}
+		for _, c := range conflictColumns {
+			skip[c] = true
+		}
+		for _, f := range fields {
+			if !skip[f.Column] {
+				updates = append(updates, f)
+			}
+		}
+	}
+
+	suffix := upsertClause(updates, fields[0], r.rowAlias(ctx))
+
+	bulk, err := r.insertChunks(ctx, "INSERT INTO "+quoteIdentifier(table), suffix, fields, values, BulkOptions{})
+	result.RowsAffected = bulk.RowsAffected
+	if err != nil {
+		return result, err
+	}
+
+	if single {
+		result.Inserted = result.RowsAffected == 1
+		result.Updated = result.RowsAffected == 2
+	}
+
+	return result, nil
+}
+
+//upsertClause builds the ON DUPLICATE KEY UPDATE clause. With nothing
+//to update, the first column is assigned to itself so duplicates are
+//accepted without changes.
+func upsertClause(updates []dbField, first dbField, rowAlias bool) string {
+	if len(updates) == 0 {
+		column := quoteIdentifier(first.Column)
+		return " ON DUPLICATE KEY UPDATE " + column + " = " + column
+	}
+
+	sets := make([]string, len(updates))
+	for i, f := range updates {
+		column := quoteIdentifier(f.Column)
+		if rowAlias {
+			sets[i] = column + " = `new`." + column
+		} else {
+			sets[i] = column + " = VALUES(" + column + ")"
+		}
+	}
+
+	clause := " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	if rowAlias {
+		clause = " AS `new`" + clause
+	}
+
+	return clause
+}
+
+//rowAlias reports whether the server supports INSERT ... AS alias
+//(MySQL 8.0.19 and later). VALUES() is used when in doubt.
+func (r runner) rowAlias(ctx context.Context) bool {
+	if r.server == nil {
+		return false
+	}
+
+	r.server.mu.Lock()
+	version := r.server.version
+	r.server.mu.Unlock()
+
+	if version == "" {
+		//Queried without the lock, like maxAllowedPacket
+		if err := r.h.QueryRowxContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+			r.log.Log(ctx, LevelWarn, "could not read server version", "error", err)
+			return false
+		}
+
+		r.server.mu.Lock()
+		r.server.version = version
+		r.server.mu.Unlock()
+	}
+
+	return supportsRowAlias(version)
+}
+
+//supportsRowAlias parses a VERSION() string such as "8.0.35" or
+//"10.11.6-MariaDB" and reports whether it is MySQL 8.0.19 or later
+func supportsRowAlias(version string) bool {
+	if strings.Contains(strings.ToLower(version), "mariadb") {
+		return false
+	}
+
+	parts := strings.SplitN(strings.SplitN(version, "-", 2)[0], ".", 3)
+	if len(parts) < 3 {
+		return false
+	}
+
+	var v [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return false
+		}
+		v[i] = n
+	}
+
+	switch {
+	case v[0] != 8:
+		return v[0] > 8
+	case v[1] != 0:
+		return v[1] > 0
+	}
+	return v[2] >= 19
+}
@@ -0,0 +1,29 @@
+package database
+
+import "testing"
+
+func TestSupportsRowAlias(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"8.0.19", true},
+		{"8.0.35", true},
+		{"8.0.18", false},
+		{"8.0.35-0ubuntu0.22.04.1", true},
+		{"8.4.0", true},
+		{"9.1.0", true},
+		{"5.7.44-log", false},
+		{"10.11.6-MariaDB", false},
+		{"11.4.2-MariaDB-ubu2404", false},
+		{"8.0", false},
+		{"", false},
+		{"garbage", false},
+	}
+
+	for _, tt := range tests {
+		if got := supportsRowAlias(tt.version); got != tt.want {
+			t.Errorf("supportsRowAlias(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}